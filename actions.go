@@ -0,0 +1,121 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"BlueOS/bluos"
+	"github.com/johnmccabe/go-bitbar"
+)
+
+// addStatusActions adds the service actions offered in /Status, e.g. love,
+// ban and skip on Radio Paradise. Clicking one runs it through the player and
+// refreshes the menu to show the new state.
+func addStatusActions(submenu *bitbar.SubMenu, client *bluos.Client, state *bluos.StateXML) {
+	for _, action := range state.Actions.Action {
+		if action.URL == "" {
+			continue
+		}
+		line := submenu.Line(fmt.Sprintf("%s %s", actionSymbol(action), actionLabel(action))).Length(MAX)
+		line.Command(createCommand(client, "action", action.Name))
+		if actionActive(action) {
+			line.Color("blue")
+		}
+	}
+}
+
+// actionLabel returns the text the service gives an action, or its name
+func actionLabel(action bluos.StatusAction) string {
+	return cmp.Or(action.AttrText, action.Name)
+}
+
+// actionActive reports whether an action's state says it is already applied,
+// e.g. a loved track
+func actionActive(action bluos.StatusAction) bool {
+	switch strings.ToLower(action.State) {
+	case "loved", "banned", "favourite", "favorite", "on", "1", "true":
+		return true
+	}
+	return false
+}
+
+// actionSymbol maps an action's name or icon file to an SF Symbol, filled
+// when the action is already applied
+func actionSymbol(action bluos.StatusAction) string {
+	key := strings.ToLower(action.Name + " " + action.Icon)
+	active := actionActive(action)
+	switch {
+	case strings.Contains(key, "love"):
+		if active {
+			return ":heart.fill:"
+		}
+		return ":heart:"
+	case strings.Contains(key, "ban"):
+		if active {
+			return ":hand.thumbsdown.fill:"
+		}
+		return ":hand.thumbsdown:"
+	case strings.Contains(key, "fav"):
+		if active {
+			return ":star.fill:"
+		}
+		return ":star:"
+	case strings.Contains(key, "skip"):
+		return ":forward.end.fill:"
+	case strings.Contains(key, "back"):
+		return ":backward.end.fill:"
+	default:
+		return ":ellipsis.circle:"
+	}
+}
+
+// actionList is the output of the action command without arguments
+type actionList []bluos.StatusAction
+
+func (l actionList) String() string {
+	if len(l) == 0 {
+		return "No actions for the current stream"
+	}
+	lines := make([]string, len(l))
+	for i, action := range l {
+		state := ""
+		if action.State != "" {
+			state = fmt.Sprintf(" (%s)", action.State)
+		}
+		lines[i] = fmt.Sprintf("%-10s %s%s", action.Name, actionLabel(action), state)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// cmdAction lists the service actions of the current stream or runs one by
+// name. The action is looked up in a fresh /Status, so a stale menu cannot
+// send an action of the previous track.
+func cmdAction(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	status, err := client.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var actions actionList
+	for _, action := range status.Actions.Action {
+		if action.URL != "" {
+			actions = append(actions, action)
+		}
+	}
+	if len(args) == 0 {
+		return actions, nil
+	}
+	if len(args) > 1 {
+		return nil, errors.New("usage: action [<name>]")
+	}
+
+	for _, action := range actions {
+		if strings.EqualFold(action.Name, args[0]) || strings.EqualFold(action.AttrText, args[0]) {
+			return messageCommand(fmt.Sprintf("%s: done", actionLabel(action)), client.RunAction(ctx, action))
+		}
+	}
+	return nil, fmt.Errorf("no action %q for the current stream", args[0])
+}
@@ -0,0 +1,504 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"BlueOS/bluos"
+	"github.com/johnmccabe/go-bitbar"
+)
+
+const (
+	alarmCheckInterval = 20 * time.Second // How often the daemon looks for due alarms
+	alarmGracePeriod   = 30 * time.Minute // How late a missed alarm still goes off, e.g. after the Mac woke from sleep
+)
+
+// alarmDays maps the day names of the alarms file to weekdays
+var alarmDays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// alarm is an entry of the alarms file, started by the daemon at its time
+type alarm struct {
+	Name      string   `json:"name,omitempty"`
+	Days      []string `json:"days,omitempty"`   // mon, tue, ... or weekdays/weekend; empty means every day
+	Time      string   `json:"time"`             // Local time, 24-hour, e.g. 07:00
+	Preset    string   `json:"preset,omitempty"` // Preset id or name
+	URL       string   `json:"url,omitempty"`    // Stream to play instead of a preset
+	Volume    int      `json:"volume,omitempty"` // Level to end at, 0 keeps the current one
+	FadeIn    duration `json:"fadeIn,omitempty"`
+	StopAfter duration `json:"stopAfter,omitempty"` // Pause with a fade-out after this long, 0 plays on
+	Disabled  bool     `json:"disabled,omitempty"`
+}
+
+// duration is a time.Duration written as text, e.g. "2m" or "1h30m"
+type duration time.Duration
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if s == "" {
+		*d = 0
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// alarmsPath returns the location of the alarms file, which is edited by hand
+func alarmsPath() string {
+	return configPath("alarms.json")
+}
+
+// loadAlarms reads the alarms file. A missing file yields no alarms.
+func loadAlarms() ([]alarm, error) {
+	data, err := os.ReadFile(alarmsPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var alarms []alarm
+	if err := json.Unmarshal(data, &alarms); err != nil {
+		return nil, fmt.Errorf("read %s: %w", alarmsPath(), err)
+	}
+	return alarms, nil
+}
+
+// saveAlarms writes the alarms file
+func saveAlarms(alarms []alarm) error {
+	return writeConfigFile(alarmsPath(), alarms)
+}
+
+// label names an alarm by its name, or by what it plays
+func (a alarm) label() string {
+	switch {
+	case a.Name != "":
+		return a.Name
+	case a.Preset != "":
+		return "Preset " + a.Preset
+	default:
+		return a.URL
+	}
+}
+
+// key identifies an alarm in the state file, which records its last run
+func (a alarm) key(i int) string {
+	return cmp.Or(a.Name, fmt.Sprintf("%d@%s", i+1, a.Time))
+}
+
+// schedule parses the time and days of an alarm
+func (a alarm) schedule() (hour, minute int, days map[time.Weekday]bool, err error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(a.Time))
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("alarm %s: invalid time %q (expected e.g. 07:00)", a.label(), a.Time)
+	}
+	if a.Preset == "" && a.URL == "" {
+		return 0, 0, nil, fmt.Errorf("alarm %s: needs a preset or url", a.label())
+	}
+
+	days = make(map[time.Weekday]bool)
+	for _, day := range a.Days {
+		switch name := strings.ToLower(strings.TrimSpace(day)); name {
+		case "weekdays":
+			for d := time.Monday; d <= time.Friday; d++ {
+				days[d] = true
+			}
+		case "weekend":
+			days[time.Saturday], days[time.Sunday] = true, true
+		default:
+			d, ok := alarmDays[name[:min(3, len(name))]]
+			if !ok {
+				return 0, 0, nil, fmt.Errorf("alarm %s: invalid day %q", a.label(), day)
+			}
+			days[d] = true
+		}
+	}
+	if len(days) == 0 {
+		for _, d := range alarmDays {
+			days[d] = true
+		}
+	}
+	return t.Hour(), t.Minute(), days, nil
+}
+
+// next returns the first time the alarm goes off after now
+func (a alarm) next(now time.Time) (time.Time, error) {
+	return a.occurrence(now, 1)
+}
+
+// previous returns the last time the alarm went off, at or before now
+func (a alarm) previous(now time.Time) (time.Time, error) {
+	return a.occurrence(now, -1)
+}
+
+// occurrence searches a week from now, forwards or backwards, for the alarm
+func (a alarm) occurrence(now time.Time, dir int) (time.Time, error) {
+	hour, minute, days, err := a.schedule()
+	if err != nil {
+		return time.Time{}, err
+	}
+	for i := 0; i <= 7; i++ {
+		day := now.AddDate(0, 0, dir*i)
+		at := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, now.Location())
+		if days[at.Weekday()] && (dir > 0 && at.After(now) || dir < 0 && !at.After(now)) {
+			return at, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("alarm %s never goes off", a.label())
+}
+
+// formatAlarmTime shows when an alarm goes off next, relative to today
+func formatAlarmTime(at, now time.Time) string {
+	y, m, d := now.Date()
+	switch at.Sub(time.Date(y, m, d, 0, 0, 0, 0, now.Location())) / (24 * time.Hour) {
+	case 0:
+		return "Today " + at.Format("15:04")
+	case 1:
+		return "Tomorrow " + at.Format("15:04")
+	default:
+		return at.Format("Mon 15:04")
+	}
+}
+
+// daemonRunning reports whether a daemon answers on its socket. A socket
+// left behind by a daemon that crashed does not count.
+func daemonRunning() bool {
+	conn, err := net.DialTimeout("unix", socketPath(), 200*time.Millisecond)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// runAlarms starts due alarms until ctx is done
+func (d *daemon) runAlarms(ctx context.Context) {
+	ticker := time.NewTicker(alarmCheckInterval)
+	defer ticker.Stop()
+	for {
+		d.checkAlarms(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkAlarms starts the alarms whose time came since their last run. An
+// alarm missed while the daemon or the Mac was asleep still goes off within
+// alarmGracePeriod; older ones are skipped, so nothing blares hours late.
+// Times that passed before an alarm was added or while it was off only count
+// as handled.
+func (d *daemon) checkAlarms(ctx context.Context, now time.Time) {
+	alarms, err := loadAlarms()
+	if err != nil {
+		log.Printf("Alarms unavailable: %v", err)
+		return
+	}
+	runs := loadState().AlarmRuns
+
+	for i, a := range alarms {
+		due, err := a.previous(now)
+		if err != nil {
+			log.Printf("Skipping %v", err)
+			continue
+		}
+		key := a.key(i)
+		if last, ok := runs[key]; ok && !due.After(last) {
+			continue
+		}
+		// Check again under the state lock, so an occurrence is only handled once
+		handled, known := false, false
+		if err := updateState(func(state *pluginState) {
+			var last time.Time
+			if last, known = state.AlarmRuns[key]; known && !due.After(last) {
+				handled = true
+				return
+			}
+			if state.AlarmRuns == nil {
+				state.AlarmRuns = make(map[string]time.Time)
+			}
+			state.AlarmRuns[key] = due
+		}); err != nil {
+			log.Printf("Failed to record alarm run, not starting %s: %v", a.label(), err)
+			continue
+		}
+
+		if handled || !known || a.Disabled {
+			continue
+		}
+		if late := now.Sub(due); late > alarmGracePeriod {
+			log.Printf("Skipping alarm %s missed by %v", a.label(), late.Round(time.Minute))
+			continue
+		}
+		log.Printf("Alarm %s due at %s", a.label(), due.Format("15:04"))
+		go d.fireAlarm(ctx, a)
+	}
+}
+
+// fireAlarm starts an alarm on the active player and pauses it again after
+// its stop time, unless something else is playing by then
+func (d *daemon) fireAlarm(ctx context.Context, a alarm) {
+	playerURL := d.snapshot().URL
+	if playerURL == "" {
+		var err error
+		if playerURL, err = getBluOSPlayerURL(ctx, myConfig["BLUE_URL"]); err != nil {
+			log.Printf("Alarm %s failed, no player: %v", a.label(), err)
+			return
+		}
+	}
+	client := bluos.NewClient(playerURL)
+
+	status, err := startAlarm(ctx, client, a)
+	if err != nil {
+		log.Printf("Alarm %s failed: %v", a.label(), err)
+		return
+	}
+	if a.StopAfter <= 0 {
+		return
+	}
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(time.Duration(a.StopAfter)):
+	}
+	if err := stopAlarm(ctx, client, status); err != nil {
+		log.Printf("Failed to stop alarm %s: %v", a.label(), err)
+	}
+}
+
+// startAlarm plays the preset or stream of an alarm, at its volume or fading
+// in to it, and returns the status it started with
+func startAlarm(ctx context.Context, client *bluos.Client, a alarm) (*bluos.StateXML, error) {
+	vol, err := client.Volume(ctx)
+	if err != nil {
+		return nil, err
+	}
+	target := min(cmp.Or(a.Volume, vol.Level), currentVolumeLimit(time.Now()).Level)
+
+	var job *fadeJob
+	if a.FadeIn > 0 {
+		// The fade is saved first, which also keeps learned volumes out while the alarm starts
+		job = &fadeJob{URL: client.BaseURL, Kind: "in", From: vol.Level, To: target, Duration: time.Duration(a.FadeIn), Started: time.Now()}
+		if err := saveFadeJob(*job); err != nil {
+			return nil, err
+		}
+		if _, err := client.SetVolume(ctx, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	if a.Preset != "" {
+		presets, err := client.Presets(ctx)
+		if err != nil {
+			return nil, err
+		}
+		preset, err := findPreset(presets, a.Preset)
+		if err != nil {
+			return nil, err
+		}
+		if err := client.PlayPreset(ctx, preset.ID); err != nil {
+			return nil, err
+		}
+	} else if _, err := client.PlayURL(ctx, a.URL); err != nil {
+		return nil, err
+	}
+	log.Printf("Alarm %s playing at %d%%", a.label(), target)
+
+	status, err := client.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claimVolumeSource(status)
+
+	if job != nil {
+		err = runFade(ctx, client, job)
+	} else {
+		_, err = setLimitedVolume(ctx, client, target)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// stopAlarm fades out and pauses an alarm that is still playing what it started
+func stopAlarm(ctx context.Context, client *bluos.Client, started *bluos.StateXML) error {
+	status, err := client.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if status.State != "play" && status.State != "stream" || status.PresetID != started.PresetID || status.StreamUrl != started.StreamUrl {
+		log.Printf("Alarm playback changed since it started, leaving it on")
+		return nil
+	}
+	vol, err := client.Volume(ctx)
+	if err != nil {
+		return err
+	}
+
+	job := fadeJob{URL: client.BaseURL, Kind: "out", From: vol.Level, To: vol.Level, Duration: fadeDuration(), Started: time.Now()}
+	if err := saveFadeJob(job); err != nil {
+		return err
+	}
+	log.Printf("Stopping alarm playback")
+	return runFade(ctx, client, &job)
+}
+
+// addAlarmsMenu adds an Alarms submenu with the next time of each alarm. A
+// click turns an alarm off or back on.
+func addAlarmsMenu(submenu *bitbar.SubMenu, client *bluos.Client) {
+	alarms, err := loadAlarms()
+	if err != nil {
+		log.Printf("Alarms unavailable: %v", err)
+		submenu.Line("⚠️ Error loading alarms").Color("red")
+		return
+	}
+	if len(alarms) == 0 {
+		return
+	}
+
+	now := time.Now()
+	var soonest time.Time
+	for _, a := range alarms {
+		if next, err := a.next(now); err == nil && !a.Disabled && (soonest.IsZero() || next.Before(soonest)) {
+			soonest = next
+		}
+	}
+	if soonest.IsZero() {
+		submenu.Line(":alarm: Alarms")
+	} else {
+		submenu.Line(":alarm.fill: Alarm " + formatAlarmTime(soonest, now))
+	}
+	alarmsMenu := submenu.NewSubMenu()
+	if !daemonRunning() {
+		alarmsMenu.Line("Alarms only go off while the daemon runs").Color("orange")
+	}
+
+	for i, a := range alarms {
+		n := strconv.Itoa(i + 1)
+		next, err := a.next(now)
+		switch {
+		case err != nil:
+			alarmsMenu.Line("⚠️ " + err.Error()).Color("red").Length(MAX)
+		case a.Disabled:
+			alarmsMenu.Line(fmt.Sprintf(":alarm: %s · off", a.label())).Color("gray").Length(MAX).Command(createCommand(client, "alarm", "enable", n))
+		default:
+			alarmsMenu.Line(fmt.Sprintf(":checkmark: %s · %s", a.label(), formatAlarmTime(next, now))).Length(MAX).Command(createCommand(client, "alarm", "disable", n))
+		}
+	}
+	alarmsMenu.Line("---")
+	alarmsMenu.Line("Click an alarm to turn it on or off").Color("gray")
+}
+
+// alarmEntry is a numbered alarm in the output of the alarm command
+type alarmEntry struct {
+	N       int        `json:"n"`
+	Name    string     `json:"name"`
+	Time    string     `json:"time"`
+	Days    []string   `json:"days,omitempty"`
+	Enabled bool       `json:"enabled"`
+	Next    *time.Time `json:"next,omitempty"`
+	Error   string     `json:"error,omitempty"`
+}
+
+// alarmList is the output of the alarm command without arguments
+type alarmList struct {
+	Path   string       `json:"path"`
+	Daemon bool         `json:"daemon"`
+	Alarms []alarmEntry `json:"alarms"`
+}
+
+func (l alarmList) String() string {
+	if len(l.Alarms) == 0 {
+		return fmt.Sprintf("No alarms in %s", l.Path)
+	}
+	now := time.Now()
+	lines := make([]string, 0, len(l.Alarms)+1)
+	for _, a := range l.Alarms {
+		when := "off"
+		switch {
+		case a.Error != "":
+			when = a.Error
+		case a.Enabled && a.Next != nil:
+			when = formatAlarmTime(*a.Next, now)
+		}
+		lines = append(lines, fmt.Sprintf("%2d  %-24s %s", a.N, a.Name, when))
+	}
+	if !l.Daemon {
+		lines = append(lines, "(the daemon is not running, alarms will not go off)")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// cmdAlarm lists the alarms with their next time, or turns one on or off
+func cmdAlarm(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	alarms, err := loadAlarms()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) == 0 || (len(args) == 1 && args[0] == "list") {
+		list := alarmList{Path: alarmsPath(), Daemon: daemonRunning(), Alarms: []alarmEntry{}}
+		for i, a := range alarms {
+			entry := alarmEntry{N: i + 1, Name: a.label(), Time: a.Time, Days: a.Days, Enabled: !a.Disabled}
+			if next, err := a.next(time.Now()); err != nil {
+				entry.Error = err.Error()
+			} else {
+				entry.Next = &next
+			}
+			list.Alarms = append(list.Alarms, entry)
+		}
+		return list, nil
+	}
+
+	if len(args) < 2 || (args[0] != "enable" && args[0] != "disable") {
+		return nil, errors.New("usage: alarm [list | enable <n|name> | disable <n|name>]")
+	}
+	i, err := findAlarm(alarms, strings.Join(args[1:], " "))
+	if err != nil {
+		return nil, err
+	}
+	alarms[i].Disabled = args[0] == "disable"
+	if err := saveAlarms(alarms); err != nil {
+		return nil, fmt.Errorf("save alarms: %w", err)
+	}
+
+	if alarms[i].Disabled {
+		return messageResult{fmt.Sprintf("Alarm %s off", alarms[i].label())}, nil
+	}
+	next, err := alarms[i].next(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return messageResult{fmt.Sprintf("Alarm %s on, next %s", alarms[i].label(), formatAlarmTime(next, time.Now()))}, nil
+}
+
+// findAlarm returns the index of an alarm given by its number (from 1), its
+// name or a unique part of the name
+func findAlarm(alarms []alarm, query string) (int, error) {
+	return findByNumberOrName(alarms, "alarm", alarm.label, query)
+}
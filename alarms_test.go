@@ -0,0 +1,174 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// at returns a time in October 2026, when the 16th is a Friday
+func at(day, hour, minute int) time.Time {
+	return time.Date(2026, time.October, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestAlarmSchedule(t *testing.T) {
+	everyDay := []time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday}
+	tests := []struct {
+		name    string
+		alarm   alarm
+		hour    int
+		minute  int
+		days    []time.Weekday
+		wantErr bool
+	}{
+		{"every day", alarm{Time: "07:30", Preset: "1"}, 7, 30, everyDay, false},
+		{"weekdays", alarm{Time: "07:00", Preset: "1", Days: []string{"weekdays"}}, 7, 0, []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}, false},
+		{"weekend", alarm{Time: "09:30", URL: "TuneIn:s1", Days: []string{"weekend"}}, 9, 30, []time.Weekday{time.Saturday, time.Sunday}, false},
+		{"day names", alarm{Time: " 6:05 ", Preset: "1", Days: []string{"Monday", " wed", "FRI"}}, 6, 5, []time.Weekday{time.Monday, time.Wednesday, time.Friday}, false},
+		{"invalid time", alarm{Time: "7am", Preset: "1"}, 0, 0, nil, true},
+		{"invalid day", alarm{Time: "07:00", Preset: "1", Days: []string{"someday"}}, 0, 0, nil, true},
+		{"nothing to play", alarm{Time: "07:00"}, 0, 0, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hour, minute, days, err := tt.alarm.schedule()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("schedule() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if hour != tt.hour || minute != tt.minute {
+				t.Errorf("schedule() time = %02d:%02d, want %02d:%02d", hour, minute, tt.hour, tt.minute)
+			}
+			if len(days) != len(tt.days) {
+				t.Errorf("schedule() days = %v, want %v", days, tt.days)
+			}
+			for _, d := range tt.days {
+				if !days[d] {
+					t.Errorf("schedule() days = %v, missing %v", days, d)
+				}
+			}
+		})
+	}
+}
+
+func TestAlarmOccurrence(t *testing.T) {
+	daily := alarm{Time: "07:00", Preset: "1"}
+	weekdays := alarm{Time: "07:00", Preset: "1", Days: []string{"weekdays"}}
+	sunday := alarm{Time: "09:30", Preset: "1", Days: []string{"sun"}}
+
+	tests := []struct {
+		name     string
+		alarm    alarm
+		now      time.Time
+		next     time.Time
+		previous time.Time
+	}{
+		{"daily before", daily, at(16, 6, 0), at(16, 7, 0), at(15, 7, 0)},
+		{"daily at time", daily, at(16, 7, 0), at(17, 7, 0), at(16, 7, 0)},
+		{"daily after", daily, at(16, 7, 1), at(17, 7, 0), at(16, 7, 0)},
+		{"weekdays on friday evening", weekdays, at(16, 20, 0), at(19, 7, 0), at(16, 7, 0)},
+		{"weekdays over the weekend", weekdays, at(18, 12, 0), at(19, 7, 0), at(16, 7, 0)},
+		{"weekdays on monday before", weekdays, at(19, 6, 0), at(19, 7, 0), at(16, 7, 0)},
+		{"weekly before", sunday, at(18, 9, 0), at(18, 9, 30), at(11, 9, 30)},
+		{"weekly at time", sunday, at(18, 9, 30), at(25, 9, 30), at(18, 9, 30)},
+		{"weekly after", sunday, at(18, 10, 0), at(25, 9, 30), at(18, 9, 30)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, err := tt.alarm.next(tt.now)
+			if err != nil || !next.Equal(tt.next) {
+				t.Errorf("next(%v) = %v, %v, want %v", tt.now, next, err, tt.next)
+			}
+			previous, err := tt.alarm.previous(tt.now)
+			if err != nil || !previous.Equal(tt.previous) {
+				t.Errorf("previous(%v) = %v, %v, want %v", tt.now, previous, err, tt.previous)
+			}
+		})
+	}
+}
+
+func TestCheckAlarms(t *testing.T) {
+	wake := alarm{Name: "Wake", Time: "07:00", Preset: "1"}
+	off := wake
+	off.Disabled = true
+	due := at(16, 7, 0)
+
+	tests := []struct {
+		name    string
+		alarm   alarm
+		lastRun time.Time // Zero when the alarm never ran
+		now     time.Time
+		fires   bool
+	}{
+		{"first sighting only records the run", wake, time.Time{}, at(16, 7, 5), false},
+		{"due since the last run", wake, at(15, 7, 0), at(16, 7, 5), true},
+		{"at the end of the grace period", wake, at(15, 7, 0), due.Add(alarmGracePeriod), true},
+		{"after the grace period", wake, at(15, 7, 0), due.Add(alarmGracePeriod + time.Second), false},
+		{"already handled", wake, due, at(16, 7, 5), false},
+		{"disabled", off, at(15, 7, 0), at(16, 7, 5), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("HOME", dir)
+			t.Setenv("XDG_CONFIG_HOME", dir)
+			if err := saveAlarms([]alarm{tt.alarm}); err != nil {
+				t.Fatal(err)
+			}
+			if !tt.lastRun.IsZero() {
+				if err := updateState(func(state *pluginState) {
+					state.AlarmRuns = map[string]time.Time{tt.alarm.key(0): tt.lastRun}
+				}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// A firing alarm asks the player for its volume first
+			requests := make(chan string, 16)
+			player := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests <- r.URL.Path
+				http.NotFound(w, r)
+			}))
+			defer player.Close()
+			d := &daemon{snap: Snapshot{URL: player.URL}}
+
+			d.checkAlarms(t.Context(), tt.now)
+			select {
+			case path := <-requests:
+				if !tt.fires {
+					t.Errorf("alarm fired (%s), want it skipped", path)
+				}
+			case <-time.After(500 * time.Millisecond):
+				if tt.fires {
+					t.Error("alarm did not fire")
+				}
+			}
+
+			// Every occurrence is recorded, fired or not, so it is handled once
+			if got := loadState().AlarmRuns[tt.alarm.key(0)]; !got.Equal(due) {
+				t.Errorf("recorded run = %v, want %v", got, due)
+			}
+		})
+	}
+}
+
+func TestFormatAlarmTime(t *testing.T) {
+	now := at(16, 22, 0)
+	tests := []struct {
+		at   time.Time
+		want string
+	}{
+		{at(16, 23, 15), "Today 23:15"},
+		{at(17, 7, 0), "Tomorrow 07:00"},
+		{at(18, 9, 30), "Sun 09:30"},
+		{at(23, 7, 0), "Fri 07:00"},
+	}
+	for _, tt := range tests {
+		if got := formatAlarmTime(tt.at, now); got != tt.want {
+			t.Errorf("formatAlarmTime(%v) = %q, want %q", tt.at, got, tt.want)
+		}
+	}
+}
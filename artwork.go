@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"BlueOS/bluos"
+)
+
+const (
+	nowPlayingArtSize = 64                 // Pixels; SwiftBar renders images at 144 DPI, so this shows at 32pt
+	presetArtSize     = 32                 // Pixels for preset logos
+	artworkTimeout    = 2 * time.Second    // Budget for downloading missing artwork in one refresh
+	artworkMaxAge     = 7 * 24 * time.Hour // Cached images older than this are removed
+)
+
+// nowPlayingArtwork returns the image for the current track or station
+func nowPlayingArtwork(state *bluos.StateXML) string {
+	return cmp.Or(state.CurrentImage, state.Image, state.ServiceIcon)
+}
+
+// artworkPath returns the cache file for an image at a given size. Relative
+// sources are keyed together with the player, since they only exist there.
+func artworkPath(client *bluos.Client, src string, size int) string {
+	if u, err := url.Parse(src); err == nil && !u.IsAbs() {
+		src = client.BaseURL + src
+	}
+	sum := sha256.Sum256([]byte(src))
+	return tmpPath(filepath.Join("blueos-artwork", fmt.Sprintf("%x-%d.png", sum[:8], size)))
+}
+
+// artworkImage returns a cached image, or nil when it has not been downloaded
+// (or could not be decoded). It never touches the network, so rendering stays fast.
+func artworkImage(client *bluos.Client, src string, size int) image.Image {
+	if src == "" {
+		return nil
+	}
+	data, err := os.ReadFile(artworkPath(client, src, size))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		log.Printf("Ignoring unreadable cached artwork for %s: %v", src, err)
+		return nil
+	}
+	return img
+}
+
+// cacheArtwork downloads the now-playing image and the preset and favourite
+// logos that are not cached yet, resized to menu size. Whatever is not done
+// within artworkTimeout is left for the next refresh.
+func cacheArtwork(ctx context.Context, client *bluos.Client, snap *Snapshot) {
+	type artwork struct {
+		src  string
+		size int
+	}
+	var wanted []artwork
+	if snap.Status != nil {
+		wanted = append(wanted, artwork{nowPlayingArtwork(snap.Status), nowPlayingArtSize})
+	}
+	if snap.Presets != nil {
+		for _, p := range snap.Presets.Preset {
+			wanted = append(wanted, artwork{p.Image, presetArtSize})
+		}
+	}
+	for _, logo := range favouriteLogos() {
+		wanted = append(wanted, artwork{logo, presetArtSize})
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, artworkTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, a := range wanted {
+		if a.src == "" {
+			continue
+		}
+		// An empty file marks an image that could not be decoded
+		if _, err := os.Stat(artworkPath(client, a.src, a.size)); err == nil {
+			continue
+		}
+		wg.Go(func() { downloadArtwork(ctx, client, a.src, a.size) })
+	}
+	wg.Wait()
+	pruneArtworkCache()
+}
+
+// pruneArtworkCache removes cached images older than artworkMaxAge, so album
+// art of every track ever played does not pile up in TMPDIR
+func pruneArtworkCache() {
+	entries, err := os.ReadDir(tmpPath("blueos-artwork"))
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < artworkMaxAge {
+			continue
+		}
+		if err := os.Remove(tmpPath(filepath.Join("blueos-artwork", entry.Name()))); err != nil {
+			log.Printf("Failed to remove old artwork: %v", err)
+		}
+	}
+}
+
+// downloadArtwork fetches one image through the player, resizes it and
+// stores it as PNG in the artwork cache
+func downloadArtwork(ctx context.Context, client *bluos.Client, src string, size int) {
+	path := artworkPath(client, src, size)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		log.Printf("Failed to create artwork cache: %v", err)
+		return
+	}
+
+	probe := *client
+	probe.Retries = 1
+	data, err := probe.Artwork(ctx, src)
+	if err != nil {
+		log.Printf("Failed to download artwork %s: %v", src, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err == nil {
+		err = png.Encode(&buf, resizeImage(img, size))
+	}
+	if err != nil {
+		// Formats such as SVG or WebP are not supported; don't retry them every refresh
+		log.Printf("Failed to decode artwork %s: %v", src, err)
+		buf.Reset()
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		log.Printf("Failed to cache artwork %s: %v", src, err)
+	}
+}
+
+// resizeImage scales img down to fit a size×size square, keeping its aspect
+// ratio, by averaging the source pixels that fall into each target pixel
+func resizeImage(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+	dw := max(1, w*size/max(w, h))
+	dh := max(1, h*size/max(w, h))
+
+	dst := image.NewRGBA64(image.Rect(0, 0, dw, dh))
+	for y := range dh {
+		y0, y1 := b.Min.Y+y*h/dh, b.Min.Y+max((y+1)*h/dh, y*h/dh+1)
+		for x := range dw {
+			x0, x1 := b.Min.X+x*w/dw, b.Min.X+max((x+1)*w/dw, x*w/dw+1)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			dst.SetRGBA64(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(bl / n), uint16(a / n)})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"BlueOS/bluos"
+	"github.com/johnmccabe/go-bitbar"
+)
+
+const (
+	autoVolumeDefaultMax = 60               // Highest level applied automatically without BLUE_AUTO_VOLUME_MAX
+	autoVolumeUndoWindow = 10 * time.Minute // How long the menu offers to undo an automatic change
+)
+
+// autoVolume records an automatic volume change so it can be undone
+type autoVolume struct {
+	Source string    `json:"source"`
+	Label  string    `json:"label"`
+	From   int       `json:"from"`
+	To     int       `json:"to"`
+	At     time.Time `json:"at"`
+}
+
+// autoVolumeMax returns the highest level the plugin sets on its own, set with
+// BLUE_AUTO_VOLUME_MAX in .env; 0 turns learned volumes off
+func autoVolumeMax() int {
+	limit, err := strconv.Atoi(myConfig["BLUE_AUTO_VOLUME_MAX"])
+	if err != nil {
+		return autoVolumeDefaultMax
+	}
+	return max(0, min(limit, 100))
+}
+
+// volumeSource returns the key under which the volume of what is playing is
+// learned: the preset when one plays, otherwise the service
+func volumeSource(state *bluos.StateXML) (key, label string) {
+	switch {
+	case state.PresetID != "":
+		return "preset:" + state.PresetID, "preset " + state.PresetID
+	case state.Service != "":
+		return "service:" + state.Service, cmp.Or(state.ServiceName, state.Service)
+	default:
+		return "", ""
+	}
+}
+
+// learnVolume remembers the level of the current source while it plays and,
+// when the source changes, applies the level learned for the new one, capped
+// at autoVolumeMax and the volume limit. It runs on every status the plugin or daemon sees and
+// returns the new volume when it changed it.
+func learnVolume(ctx context.Context, client *bluos.Client, status *bluos.StateXML) *bluos.VolumeStatus {
+	limit := autoVolumeMax()
+	source, label := volumeSource(status)
+	level, err := strconv.Atoi(status.Volume)
+	if limit == 0 || source == "" || err != nil || level < 0 {
+		return nil
+	}
+	// Only levels picked while listening count, not those of a fade or mute
+	if status.State != "play" && status.State != "stream" || status.Mute == "1" || fading(client.BaseURL) {
+		return nil
+	}
+
+	state := loadState()
+	learned, known := state.Volumes[source]
+	if source == state.VolumeSource || !known {
+		if source != state.VolumeSource || learned != level || !known {
+			if err := updateState(func(state *pluginState) {
+				state.VolumeSource = source
+				state.setVolume(source, level)
+			}); err != nil {
+				log.Printf("Failed to save learned volume: %v", err)
+			}
+		}
+		return nil
+	}
+
+	// The source changed to one with a learned level
+	var (
+		change *autoVolume
+		vol    *bluos.VolumeStatus
+	)
+	if target := min(learned, limit, currentVolumeLimit(time.Now()).Level); target != level {
+		log.Printf("Applying learned volume %d%% for %s (was %d%%)", target, label, level)
+		if vol, err = setLimitedVolume(ctx, client, target); err != nil {
+			log.Printf("Failed to apply learned volume: %v", err)
+			return nil
+		}
+		change = &autoVolume{Source: source, Label: label, From: level, To: target, At: time.Now()}
+	}
+	if err := updateState(func(state *pluginState) {
+		state.VolumeSource = source
+		if change != nil {
+			state.AutoVolume = change
+		}
+	}); err != nil {
+		log.Printf("Failed to save learned volume: %v", err)
+	}
+	return vol
+}
+
+// claimVolumeSource records the source in status as the one playing, so a
+// level set right after starting it is kept and learned instead of replaced
+// by the level learned before
+func claimVolumeSource(status *bluos.StateXML) {
+	source, _ := volumeSource(status)
+	if source == "" {
+		return
+	}
+	if err := updateState(func(state *pluginState) { state.VolumeSource = source }); err != nil {
+		log.Printf("Failed to save volume source: %v", err)
+	}
+}
+
+// setVolume stores the learned level of a source
+func (s *pluginState) setVolume(source string, level int) {
+	if s.Volumes == nil {
+		s.Volumes = make(map[string]int)
+	}
+	s.Volumes[source] = level
+}
+
+// pendingAutoVolume returns the last automatic change while it can still be
+// undone: it is recent and the same source still plays
+func pendingAutoVolume(status *bluos.StateXML) *autoVolume {
+	change := loadState().AutoVolume
+	if change == nil || time.Since(change.At) > autoVolumeUndoWindow {
+		return nil
+	}
+	if source, _ := volumeSource(status); source != change.Source {
+		return nil
+	}
+	return change
+}
+
+// addAutoVolumeUndo adds a line to undo the last automatic volume change
+func addAutoVolumeUndo(submenu *bitbar.SubMenu, client *bluos.Client, status *bluos.StateXML) {
+	if status == nil {
+		return
+	}
+	if change := pendingAutoVolume(status); change != nil {
+		submenu.Line(fmt.Sprintf(":arrow.uturn.backward: Undo volume for %s (%d%% → %d%%)", change.Label, change.To, change.From)).
+			Length(MAX).Command(createCommand(client, "volume", "undo"))
+	}
+}
+
+// undoAutoVolume restores the level from before the last automatic change.
+// The restored level is then learned for the source.
+func undoAutoVolume(ctx context.Context, client *bluos.Client) (any, error) {
+	status, err := client.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	change := pendingAutoVolume(status)
+	if change == nil {
+		return nil, errors.New("no automatic volume change to undo")
+	}
+
+	vol, err := setLimitedVolume(ctx, client, change.From)
+	if err != nil {
+		return nil, err
+	}
+	if err := updateState(func(state *pluginState) {
+		state.AutoVolume = nil
+		state.setVolume(change.Source, change.From)
+	}); err != nil {
+		return nil, fmt.Errorf("save learned volume: %w", err)
+	}
+	return volumeResult{vol}, nil
+}
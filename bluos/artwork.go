@@ -0,0 +1,21 @@
+package bluos
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// Artwork downloads an image referenced by the player, such as StateXML.Image
+// or a preset logo. Relative paths (/Artwork?...) are fetched from the player,
+// absolute URLs as they are.
+func (c *Client) Artwork(ctx context.Context, src string) ([]byte, error) {
+	u, err := url.Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid artwork URL %q: %w", src, err)
+	}
+	if u.IsAbs() {
+		return c.fetch(ctx, src, c.Timeout)
+	}
+	return c.Get(ctx, u.Path, u.Query())
+}
@@ -0,0 +1,91 @@
+package bluos
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+)
+
+// BrowseResult is one level of the /Browse hierarchy: music services, inputs,
+// the local library and their menus, stations, albums and tracks
+type BrowseResult struct {
+	XMLName    xml.Name         `xml:"browse" json:"-"`
+	Type       string           `xml:"type,attr" json:"type"`
+	SearchKey  string           `xml:"searchKey,attr" json:"searchKey"` // Set when the level can be searched
+	NextKey    string           `xml:"nextKey,attr" json:"nextKey"`     // Set when there are more items
+	Items      []BrowseItem     `xml:"item" json:"items,omitempty"`
+	Categories []BrowseCategory `xml:"category" json:"categories,omitempty"`
+}
+
+// BrowseCategory groups items within a level, e.g. Stations or Shows
+type BrowseCategory struct {
+	Text  string       `xml:"text,attr" json:"text"`
+	Items []BrowseItem `xml:"item" json:"items,omitempty"`
+}
+
+// BrowseItem is an entry of a /Browse level. Items with a BrowseKey lead to
+// another level; items with a PlayURL or AutoplayURL can be played.
+type BrowseItem struct {
+	Text        string `xml:"text,attr" json:"text"`
+	Text2       string `xml:"text2,attr" json:"text2"`
+	Image       string `xml:"image,attr" json:"image"`
+	Type        string `xml:"type,attr" json:"type"` // e.g. link, audio, album, artist
+	BrowseKey   string `xml:"browseKey,attr" json:"browseKey"`
+	PlayURL     string `xml:"playURL,attr" json:"playUrl"`         // Path on the player, e.g. /Play?url=...
+	AutoplayURL string `xml:"autoplayURL,attr" json:"autoplayUrl"` // Plays the item and what follows it
+	ActionURL   string `xml:"actionURL,attr" json:"actionUrl"`
+}
+
+// AllItems returns the items of the level followed by those of its categories
+func (b *BrowseResult) AllItems() []BrowseItem {
+	items := b.Items
+	for _, c := range b.Categories {
+		items = append(items, c.Items...)
+	}
+	return items
+}
+
+// Playable reports whether the item can be started
+func (i BrowseItem) Playable() bool {
+	return i.PlayURL != "" || i.AutoplayURL != ""
+}
+
+// Browse returns a level of the browse hierarchy; an empty key returns the
+// top level with the services and inputs (/Browse?key=)
+func (c *Client) Browse(ctx context.Context, key string) (*BrowseResult, error) {
+	var query url.Values
+	if key != "" {
+		query = url.Values{"key": {key}}
+	}
+	var result BrowseResult
+	if err := c.getXML(ctx, "/Browse", query, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// PlayItem starts a browse item, preferring its autoplay URL so albums and
+// playlists continue after the chosen track
+func (c *Client) PlayItem(ctx context.Context, item BrowseItem) error {
+	target := item.AutoplayURL
+	if target == "" {
+		target = item.PlayURL
+	}
+	if target == "" {
+		return fmt.Errorf("%q cannot be played", item.Text)
+	}
+	return c.getPath(ctx, target)
+}
+
+// getPath calls a path with query as handed out by the player, e.g. in
+// /Status actions or /Browse items. Only the path and query are used, so
+// absolute URLs also go to this player.
+func (c *Client) getPath(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid player URL %q: %w", rawURL, err)
+	}
+	_, err = c.do(ctx, u.Path, u.Query())
+	return err
+}
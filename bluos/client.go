@@ -0,0 +1,174 @@
+// Package bluos is a small typed client for the BluOS Custom Integration API.
+//
+// It is used by the SwiftBar plugin but has no dependency on it, so other
+// tools can talk to BluOS players through the same code.
+package bluos
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultPort is the HTTP port BluOS players listen on
+const DefaultPort = 11000
+
+// Client talks to a single BluOS player
+type Client struct {
+	BaseURL    string        // Player URL, e.g. http://192.168.1.101:11000
+	HTTP       *http.Client  // Shared HTTP client used for every request
+	Timeout    time.Duration // Timeout applied to each request attempt
+	Retries    int           // Number of attempts for each read; changes are sent once
+	RetryDelay time.Duration // Delay between attempts
+	Logger     *log.Logger   // Destination for request logging
+}
+
+// NewClient returns a client for the player at baseURL using the plugin defaults
+// (10s timeout per attempt, 3 attempts for reads)
+func NewClient(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTP:       &http.Client{},
+		Timeout:    10 * time.Second,
+		Retries:    3,
+		RetryDelay: 500 * time.Millisecond,
+		Logger:     log.Default(),
+	}
+}
+
+// URL builds the full URL for an API endpoint
+func (c *Client) URL(path string, query url.Values) string {
+	u := c.BaseURL + "/" + strings.TrimLeft(path, "/")
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+func (c *Client) logf(format string, args ...any) {
+	if c.Logger != nil {
+		c.Logger.Printf(format, args...)
+	}
+}
+
+// Get fetches an endpoint and returns the raw response body.
+// Failed attempts are retried unless the context is done.
+func (c *Client) Get(ctx context.Context, path string, query url.Values) ([]byte, error) {
+	return c.get(ctx, path, query, c.Timeout, c.Retries)
+}
+
+// do calls an endpoint that changes the player, once. A request that timed
+// out may still have been carried out, so repeating a relative change such as
+// a skip or a dB step could apply it twice.
+func (c *Client) do(ctx context.Context, path string, query url.Values) ([]byte, error) {
+	return c.get(ctx, path, query, c.Timeout, 1)
+}
+
+// get performs a GET with up to attempts tries, applying timeout to every attempt
+func (c *Client) get(ctx context.Context, path string, query url.Values, timeout time.Duration, attempts int) ([]byte, error) {
+	endpoint := c.URL(path, query)
+	attempts = max(attempts, 1)
+
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		c.logf("Attempt %d/%d to fetch from %s", attempt, attempts, endpoint)
+
+		data, err := c.fetch(ctx, endpoint, timeout)
+		if err == nil {
+			c.logf("Successfully retrieved %d bytes from %s on attempt %d/%d", len(data), endpoint, attempt, attempts)
+			return data, nil
+		}
+		c.logf("Error fetching %s (attempt %d/%d): %v", endpoint, attempt, attempts, err)
+		// An attempt cut short by ctx keeps the failure of the attempt before it
+		if lastErr == nil || ctx.Err() == nil {
+			lastErr = err
+		}
+
+		if ctx.Err() != nil || attempt == attempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(c.RetryDelay): // Short delay between retries
+		}
+	}
+
+	return nil, lastErr
+}
+
+// fetch performs a single request attempt. A player that does not answer
+// within timeout fails like any other player error; only the deadline of ctx
+// is reported as context.DeadlineExceeded.
+func (c *Client) fetch(ctx context.Context, endpoint string, timeout time.Duration) ([]byte, error) {
+	attemptCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	requestErr := func(err error) error {
+		if ctx.Err() == nil && attemptCtx.Err() != nil {
+			err = fmt.Errorf("no answer within %v", timeout)
+		}
+		return &RequestError{URL: endpoint, Err: err}
+	}
+
+	req, err := http.NewRequestWithContext(attemptCtx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, &RequestError{URL: endpoint, Err: err}
+	}
+
+	httpClient := c.HTTP
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, requestErr(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{URL: endpoint, StatusCode: resp.StatusCode}
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, requestErr(fmt.Errorf("read body: %w", err))
+	}
+	return data, nil
+}
+
+// getXML fetches an endpoint and decodes the XML response into v
+func (c *Client) getXML(ctx context.Context, path string, query url.Values, v any) error {
+	data, err := c.Get(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	return decodeXML(c.URL(path, query), data, v)
+}
+
+// doXML calls an endpoint that changes the player, once, and decodes the XML
+// response into v
+func (c *Client) doXML(ctx context.Context, path string, query url.Values, v any) error {
+	data, err := c.do(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	return decodeXML(c.URL(path, query), data, v)
+}
+
+// decodeXML unmarshals a response body, wrapping failures in a ParseError
+func decodeXML(endpoint string, data []byte, v any) error {
+	if err := xml.Unmarshal(data, v); err != nil {
+		return &ParseError{URL: endpoint, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package bluos
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RequestError is returned when a player could not be reached or the
+// response could not be read
+type RequestError struct {
+	URL string
+	Err error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("GET %s: %v", e.URL, e.Err)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// StatusError is returned when a player answers with a non-200 HTTP status
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("GET %s: status %d", e.URL, e.StatusCode)
+}
+
+// ParseError is returned when a player response is not the expected XML
+type ParseError struct {
+	URL string
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("parse %s: %v", e.URL, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// IsUnreachable reports whether err means the player did not answer at all,
+// as opposed to answering with an error status or malformed XML
+func IsUnreachable(err error) bool {
+	var reqErr *RequestError
+	return errors.As(err, &reqErr)
+}
@@ -0,0 +1,78 @@
+package bluos
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// Grouped reports whether the player leads a group or is a secondary in one
+func (s *SyncStatus) Grouped() bool {
+	return s.Master != nil || len(s.Slaves) > 0
+}
+
+// LeaderAddress returns the host:port of the group leader when this player is
+// a secondary, or an empty string otherwise
+func (s *SyncStatus) LeaderAddress() string {
+	if s.Master == nil {
+		return ""
+	}
+	return net.JoinHostPort(s.Master.Address, portOrDefault(s.Master.Port))
+}
+
+// MemberAddresses returns the host:port of every secondary in the group this
+// player leads
+func (s *SyncStatus) MemberAddresses() []string {
+	addrs := make([]string, len(s.Slaves))
+	for i, slave := range s.Slaves {
+		addrs[i] = net.JoinHostPort(slave.Address, portOrDefault(slave.Port))
+	}
+	return addrs
+}
+
+// AddSlave adds the player at address (host:port) as a secondary to the group
+// led by this player (/AddSlave)
+func (c *Client) AddSlave(ctx context.Context, address string) error {
+	query, err := slaveQuery(address)
+	if err != nil {
+		return err
+	}
+	_, err = c.do(ctx, "/AddSlave", query)
+	return err
+}
+
+// RemoveSlave removes the player at address (host:port) from the group led by
+// this player (/RemoveSlave)
+func (c *Client) RemoveSlave(ctx context.Context, address string) error {
+	query, err := slaveQuery(address)
+	if err != nil {
+		return err
+	}
+	_, err = c.do(ctx, "/RemoveSlave", query)
+	return err
+}
+
+// MovePlayback hands the current stream or queue over to the player at
+// address (host:port). It is only offered when StateXML.CanMovePlayback is true.
+func (c *Client) MovePlayback(ctx context.Context, address string) error {
+	_, err := c.do(ctx, "/MovePlayback", url.Values{"target": {address}})
+	return err
+}
+
+// slaveQuery builds the slave and port parameters for a host:port address
+func slaveQuery(address string) (url.Values, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid player address %q: %w", address, err)
+	}
+	return url.Values{"slave": {host}, "port": {port}}, nil
+}
+
+// portOrDefault returns port, or DefaultPort when the player omitted it
+func portOrDefault(port string) string {
+	if port == "" {
+		return fmt.Sprint(DefaultPort)
+	}
+	return port
+}
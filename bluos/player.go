@@ -0,0 +1,226 @@
+package bluos
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// RepeatMode is the value of StateXML.Repeat and the /Repeat state parameter
+type RepeatMode int
+
+const (
+	RepeatAll RepeatMode = 0 // Repeat the whole queue
+	RepeatOne RepeatMode = 1 // Repeat the current track
+	RepeatOff RepeatMode = 2 // No repeat
+)
+
+// ParseRepeatMode converts a StateXML.Repeat value; anything unknown is RepeatOff
+func ParseRepeatMode(s string) RepeatMode {
+	switch s {
+	case "0":
+		return RepeatAll
+	case "1":
+		return RepeatOne
+	default:
+		return RepeatOff
+	}
+}
+
+func (m RepeatMode) String() string {
+	switch m {
+	case RepeatAll:
+		return "all"
+	case RepeatOne:
+		return "one"
+	default:
+		return "off"
+	}
+}
+
+// sleepState is the <sleep> document returned by /Sleep
+type sleepState struct {
+	XMLName xml.Name `xml:"sleep"`
+	Minutes string   `xml:",chardata"`
+}
+
+// playbackState is the <state> document returned by playback commands
+type playbackState struct {
+	XMLName xml.Name `xml:"state"`
+	State   string   `xml:",chardata"`
+}
+
+// Status returns the current player status (/Status)
+func (c *Client) Status(ctx context.Context) (*StateXML, error) {
+	var state StateXML
+	if err := c.getXML(ctx, "/Status", nil, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// Volume returns the current volume settings (/Volume)
+func (c *Client) Volume(ctx context.Context) (*VolumeStatus, error) {
+	return c.volume(ctx, nil)
+}
+
+// Presets returns the presets stored on the player (/Presets)
+func (c *Client) Presets(ctx context.Context) (*Presets, error) {
+	var presets Presets
+	if err := c.getXML(ctx, "/Presets", nil, &presets); err != nil {
+		return nil, err
+	}
+	return &presets, nil
+}
+
+// SyncStatus returns the player identity and grouping (/SyncStatus)
+func (c *Client) SyncStatus(ctx context.Context) (*SyncStatus, error) {
+	var sync SyncStatus
+	if err := c.getXML(ctx, "/SyncStatus", nil, &sync); err != nil {
+		return nil, err
+	}
+	return &sync, nil
+}
+
+// PlayPreset starts the preset with the given id (/Preset?id=)
+func (c *Client) PlayPreset(ctx context.Context, id string) error {
+	_, err := c.do(ctx, "/Preset", url.Values{"id": {id}})
+	return err
+}
+
+// StepPreset starts the preset step places after the current one, e.g. 1 for
+// the next and -1 for the previous preset (/Preset?id=+1)
+func (c *Client) StepPreset(ctx context.Context, step int) error {
+	_, err := c.do(ctx, "/Preset", url.Values{"id": {fmt.Sprintf("%+d", step)}})
+	return err
+}
+
+// Play starts or resumes playback and returns the new player state
+func (c *Client) Play(ctx context.Context) (string, error) {
+	return c.playback(ctx, "/Play", nil)
+}
+
+// PlayURL starts playing a stream URL and returns the new player state (/Play?url=)
+func (c *Client) PlayURL(ctx context.Context, streamURL string) (string, error) {
+	return c.playback(ctx, "/Play", url.Values{"url": {streamURL}})
+}
+
+// Pause pauses playback and returns the new player state
+func (c *Client) Pause(ctx context.Context) (string, error) {
+	return c.playback(ctx, "/Pause", nil)
+}
+
+// TogglePause toggles between play and pause and returns the new player state
+func (c *Client) TogglePause(ctx context.Context) (string, error) {
+	return c.playback(ctx, "/Pause", url.Values{"toggle": {"1"}})
+}
+
+// Stop stops playback and returns the new player state
+func (c *Client) Stop(ctx context.Context) (string, error) {
+	return c.playback(ctx, "/Stop", nil)
+}
+
+// Skip jumps to the next track in the queue
+func (c *Client) Skip(ctx context.Context) error {
+	_, err := c.do(ctx, "/Skip", nil)
+	return err
+}
+
+// Back restarts the current track, or goes to the previous one near its start
+func (c *Client) Back(ctx context.Context) error {
+	_, err := c.do(ctx, "/Back", nil)
+	return err
+}
+
+// Seek jumps to a position in the current track and returns the new player state
+func (c *Client) Seek(ctx context.Context, secs int) (string, error) {
+	return c.playback(ctx, "/Play", url.Values{"seek": {strconv.Itoa(secs)}})
+}
+
+// RunAction calls the URL of a service action from /Status on the player
+func (c *Client) RunAction(ctx context.Context, action StatusAction) error {
+	if action.URL == "" {
+		return fmt.Errorf("action %q has no URL", action.Name)
+	}
+	return c.getPath(ctx, action.URL)
+}
+
+// SleepSteps are the sleep timer values /Sleep cycles through, in minutes; 0 is off
+var SleepSteps = []int{15, 30, 45, 60, 90, 0}
+
+// CycleSleep advances the sleep timer to its next value in SleepSteps and
+// returns it in minutes, 0 when the timer is off (/Sleep)
+func (c *Client) CycleSleep(ctx context.Context) (int, error) {
+	var sleep sleepState
+	if err := c.doXML(ctx, "/Sleep", nil, &sleep); err != nil {
+		return 0, err
+	}
+	return ParseSleep(sleep.Minutes), nil
+}
+
+// ParseSleep converts StateXML.Sleep or a /Sleep answer to minutes, 0 when off
+func ParseSleep(s string) int {
+	minutes, _ := strconv.Atoi(strings.TrimSpace(s))
+	return minutes
+}
+
+// SetShuffle turns queue shuffling on or off
+func (c *Client) SetShuffle(ctx context.Context, on bool) error {
+	state := "0"
+	if on {
+		state = "1"
+	}
+	_, err := c.do(ctx, "/Shuffle", url.Values{"state": {state}})
+	return err
+}
+
+// SetRepeat sets the repeat mode (RepeatAll, RepeatOne or RepeatOff)
+func (c *Client) SetRepeat(ctx context.Context, mode RepeatMode) error {
+	_, err := c.do(ctx, "/Repeat", url.Values{"state": {strconv.Itoa(int(mode))}})
+	return err
+}
+
+// SetVolume sets the absolute volume level (0-100)
+func (c *Client) SetVolume(ctx context.Context, level int) (*VolumeStatus, error) {
+	return c.volume(ctx, url.Values{"level": {strconv.Itoa(level)}})
+}
+
+// AdjustVolume changes the volume by a relative amount of dB
+func (c *Client) AdjustVolume(ctx context.Context, db float64) (*VolumeStatus, error) {
+	return c.volume(ctx, url.Values{"db": {strconv.FormatFloat(db, 'f', 1, 64)}})
+}
+
+// SetMute mutes or unmutes the player
+func (c *Client) SetMute(ctx context.Context, mute bool) (*VolumeStatus, error) {
+	value := "0"
+	if mute {
+		value = "1"
+	}
+	return c.volume(ctx, url.Values{"mute": {value}})
+}
+
+// volume calls /Volume with the given parameters and decodes the resulting
+// state. Only the plain read is retried.
+func (c *Client) volume(ctx context.Context, query url.Values) (*VolumeStatus, error) {
+	call := c.getXML
+	if len(query) > 0 {
+		call = c.doXML
+	}
+	var vol VolumeStatus
+	if err := call(ctx, "/Volume", query, &vol); err != nil {
+		return nil, err
+	}
+	return &vol, nil
+}
+
+// playback calls a playback endpoint and returns the <state> it reports
+func (c *Client) playback(ctx context.Context, path string, query url.Values) (string, error) {
+	var state playbackState
+	if err := c.doXML(ctx, path, query, &state); err != nil {
+		return "", err
+	}
+	return state.State, nil
+}
@@ -0,0 +1,54 @@
+package bluos
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// Playlist returns the play queue entries from start to end inclusive (/Playlist)
+func (c *Client) Playlist(ctx context.Context, start, end int) (*Playlist, error) {
+	query := url.Values{
+		"start": {strconv.Itoa(start)},
+		"end":   {strconv.Itoa(end)},
+	}
+	var playlist Playlist
+	if err := c.getXML(ctx, "/Playlist", query, &playlist); err != nil {
+		return nil, err
+	}
+	return &playlist, nil
+}
+
+// PlayQueueEntry jumps to a queue entry and returns the new player state
+func (c *Client) PlayQueueEntry(ctx context.Context, id int) (string, error) {
+	return c.playback(ctx, "/Play", url.Values{"id": {strconv.Itoa(id)}})
+}
+
+// AddToQueue appends a track, identified by its file name as listed in the
+// queue (e.g. Tidal:12345), to the end of the play queue (/Add)
+func (c *Client) AddToQueue(ctx context.Context, file string) error {
+	_, err := c.do(ctx, "/Add", url.Values{"file": {file}, "where": {"last"}})
+	return err
+}
+
+// ClearQueue removes every entry from the play queue
+func (c *Client) ClearQueue(ctx context.Context) error {
+	_, err := c.do(ctx, "/Clear", nil)
+	return err
+}
+
+// DeleteQueueEntry removes one entry from the play queue
+func (c *Client) DeleteQueueEntry(ctx context.Context, id int) error {
+	_, err := c.do(ctx, "/Delete", url.Values{"id": {strconv.Itoa(id)}})
+	return err
+}
+
+// MoveQueueEntry moves the entry at position from to position to
+func (c *Client) MoveQueueEntry(ctx context.Context, from, to int) error {
+	query := url.Values{
+		"old": {strconv.Itoa(from)},
+		"new": {strconv.Itoa(to)},
+	}
+	_, err := c.do(ctx, "/Move", query)
+	return err
+}
@@ -0,0 +1,45 @@
+package bluos
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// SearchResult is the answer to /Search: the matches of one service, usually
+// in categories such as Artists, Albums, Tracks or Stations
+type SearchResult struct {
+	Service    string           `xml:"service,attr" json:"service"`
+	Items      []BrowseItem     `xml:"item" json:"items,omitempty"`
+	Categories []BrowseCategory `xml:"category" json:"categories,omitempty"`
+}
+
+// Search looks up query in a music service, e.g. TuneIn, Tidal or LocalMusic (/Search)
+func (c *Client) Search(ctx context.Context, service, query string) (*SearchResult, error) {
+	var result SearchResult
+	if err := c.getXML(ctx, "/Search", url.Values{"service": {service}, "expr": {query}}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Queueable reports whether the item can be appended to the play queue, which
+// is the case for tracks, albums and playlists added with /Add
+func (i BrowseItem) Queueable() bool {
+	u, err := url.Parse(i.PlayURL)
+	return err == nil && u.Path == "/Add"
+}
+
+// QueueItem appends a track, album or playlist from /Browse or /Search to the
+// end of the play queue instead of playing it now
+func (c *Client) QueueItem(ctx context.Context, item BrowseItem) error {
+	if !item.Queueable() {
+		return fmt.Errorf("%q cannot be added to the queue", item.Text)
+	}
+	u, _ := url.Parse(item.PlayURL)
+	query := u.Query()
+	query.Del("playnow")
+	query.Set("where", "last")
+	_, err := c.do(ctx, u.Path, query)
+	return err
+}
@@ -0,0 +1,136 @@
+package bluos
+
+import (
+	"encoding/xml"
+)
+
+// StateXML represents the structure of the BluOS /Status response XML
+type StateXML struct {
+	Text    string `xml:",chardata" json:"-"`
+	Etag    string `xml:"etag,attr" json:"etag"`
+	Actions struct {
+		Text   string         `xml:",chardata" json:"-"`
+		Action []StatusAction `xml:"action" json:"action,omitempty"`
+	} `xml:"actions,omitempty" json:"actions,omitempty"`
+	Album           string `xml:"album,omitempty" json:"album,omitempty"`
+	Artist          string `xml:"artist,omitempty" json:"artist,omitempty"`
+	CanMovePlayback string `xml:"canMovePlayback" json:"canMovePlayback"`
+	CanSeek         string `xml:"canSeek" json:"canSeek"`
+	CurrentImage    string `xml:"currentImage" json:"currentImage"`
+	Cursor          string `xml:"cursor" json:"cursor"`
+	Db              string `xml:"db" json:"db"`
+	Image           string `xml:"image" json:"image"`
+	Indexing        string `xml:"indexing" json:"indexing"`
+	Mid             string `xml:"mid" json:"mid"`
+	Mode            string `xml:"mode" json:"mode"`
+	Mute            string `xml:"mute" json:"mute"`
+	Name            string `xml:"name,omitempty" json:"name,omitempty"`
+	Pid             string `xml:"pid" json:"pid"`
+	PresetID        string `xml:"preset_id" json:"presetId"`
+	Prid            string `xml:"prid" json:"prid"`
+	Quality         string `xml:"quality" json:"quality"`
+	Repeat          string `xml:"repeat" json:"repeat"`
+	Service         string `xml:"service" json:"service"`
+	ServiceIcon     string `xml:"serviceIcon" json:"serviceIcon"`
+	ServiceName     string `xml:"serviceName" json:"serviceName"`
+	Shuffle         string `xml:"shuffle" json:"shuffle"`
+	Sid             string `xml:"sid" json:"sid"`
+	Sleep           string `xml:"sleep" json:"sleep"`
+	Song            string `xml:"song" json:"song"`
+	State           string `xml:"state" json:"state"`
+	StreamFormat    string `xml:"streamFormat" json:"streamFormat"`
+	StreamUrl       string `xml:"streamUrl" json:"streamUrl"`
+	SyncStat        string `xml:"syncStat" json:"syncStat"`
+	Title1          string `xml:"title1" json:"title1"`
+	Title2          string `xml:"title2" json:"title2"`
+	Title3          string `xml:"title3" json:"title3"`
+	Totlen          string `xml:"totlen,omitempty" json:"totlen,omitempty"`
+	Volume          string `xml:"volume" json:"volume"`
+	Secs            string `xml:"secs" json:"secs"`
+}
+
+// StatusAction is a service-specific action offered in /Status, such as
+// love, ban or skip on Radio Paradise
+type StatusAction struct {
+	Text     string `xml:",chardata" json:"-"`
+	Name     string `xml:"name,attr" json:"name"`
+	URL      string `xml:"url,attr" json:"url"` // Path on the player, e.g. /Action?service=RadioParadise&love=1
+	Icon     string `xml:"icon,attr" json:"icon"`
+	State    string `xml:"state,attr" json:"state"` // e.g. loved or unloved
+	AttrText string `xml:"text,attr" json:"label"`  // Label, e.g. Love
+	Type     string `xml:"type,attr" json:"type"`
+}
+
+// Presets represents the structure of the BluOS /Presets response XML
+type Presets struct {
+	XMLName xml.Name `xml:"presets" json:"-"`
+	Text    string   `xml:",chardata" json:"-"`
+	Prid    string   `xml:"prid,attr" json:"prid"`
+	Preset  []struct {
+		Text  string `xml:",chardata" json:"-"`
+		URL   string `xml:"url,attr" json:"url"`
+		ID    string `xml:"id,attr" json:"id"`
+		Name  string `xml:"name,attr" json:"name"`
+		Image string `xml:"image,attr" json:"image"`
+	} `xml:"preset" json:"preset"`
+}
+
+// VolumeStatus represents the structure of the BluOS /Volume response XML
+type VolumeStatus struct {
+	XMLName    xml.Name `xml:"volume" json:"-"`
+	Db         float64  `xml:"db,attr" json:"db"`                           // Volume level in dB
+	Mute       int      `xml:"mute,attr" json:"mute"`                       // 1 if muted, 0 if not
+	MuteDb     *float64 `xml:"muteDb,attr" json:"muteDb,omitempty"`         // Volume level in dB before mute
+	MuteVolume *int     `xml:"muteVolume,attr" json:"muteVolume,omitempty"` // Volume level before mute
+	OffsetDb   float64  `xml:"offsetDb,attr" json:"offsetDb"`               // Volume offset in dB
+	Etag       string   `xml:"etag,attr" json:"etag"`                       // Entity tag for caching
+	Level      int      `xml:",chardata" json:"level"`                      // Current volume level (0-100)
+}
+
+// SyncStatus represents the structure of the BluOS /SyncStatus response XML
+type SyncStatus struct {
+	XMLName   xml.Name     `xml:"SyncStatus" json:"-"`
+	Etag      string       `xml:"etag,attr" json:"etag"`
+	ID        string       `xml:"id,attr" json:"id"`               // Player address as ip:port
+	Name      string       `xml:"name,attr" json:"name"`           // Friendly room name
+	Model     string       `xml:"model,attr" json:"model"`         // Model code, e.g. N130
+	ModelName string       `xml:"modelName,attr" json:"modelName"` // Marketing name, e.g. NODE
+	Brand     string       `xml:"brand,attr" json:"brand"`
+	Icon      string       `xml:"icon,attr" json:"icon"`
+	Group     string       `xml:"group,attr" json:"group"`        // Group name when grouped
+	Volume    int          `xml:"volume,attr" json:"volume"`      // Volume level (0-100)
+	Master    *SyncMaster  `xml:"master" json:"master,omitempty"` // Set when this player is a secondary
+	Slaves    []SyncMember `xml:"slave" json:"slaves,omitempty"`  // Set when this player leads a group
+}
+
+// SyncMaster is the group leader reported by a secondary player
+type SyncMaster struct {
+	Address string `xml:",chardata" json:"address"`
+	Port    string `xml:"port,attr" json:"port"`
+}
+
+// SyncMember is a secondary player reported by a group leader
+type SyncMember struct {
+	Address string `xml:"id,attr" json:"address"`
+	Port    string `xml:"port,attr" json:"port"`
+}
+
+// Playlist represents the structure of the BluOS /Playlist response XML (the play queue)
+type Playlist struct {
+	XMLName  xml.Name       `xml:"playlist" json:"-"`
+	ID       string         `xml:"id,attr" json:"id"` // Playlist id, matches StateXML.Pid
+	Name     string         `xml:"name,attr" json:"name"`
+	Modified string         `xml:"modified,attr" json:"modified"`
+	Length   int            `xml:"length,attr" json:"length"` // Total number of entries, even when paged
+	Songs    []PlaylistSong `xml:"song" json:"songs,omitempty"`
+}
+
+// PlaylistSong is one entry of the play queue
+type PlaylistSong struct {
+	ID      int    `xml:"id,attr" json:"id"` // Position in the queue, matches StateXML.Song
+	Service string `xml:"service,attr" json:"service"`
+	Title   string `xml:"title" json:"title"`
+	Artist  string `xml:"art" json:"artist"`
+	Album   string `xml:"alb" json:"album"`
+	File    string `xml:"fn" json:"file"` // Service file name, used to queue the track elsewhere
+}
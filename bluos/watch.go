@@ -0,0 +1,155 @@
+package bluos
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultPollTimeout is how long the player may hold a long-poll request open
+const DefaultPollTimeout = 100 * time.Second
+
+// EventType identifies which endpoint produced a watch event
+type EventType int
+
+const (
+	StatusChanged EventType = iota // /Status etag changed
+	VolumeChanged                  // /Volume etag changed
+)
+
+// Event is emitted by Watch when a long-polled resource changes or polling fails
+type Event struct {
+	Type   EventType
+	Status *StateXML     // Set for StatusChanged events
+	Volume *VolumeStatus // Set for VolumeChanged events
+	Err    error         // Set when polling failed; Status and Volume are nil
+}
+
+// WaitStatus long-polls /Status. The player answers as soon as its etag differs
+// from etag, or after timeout with the unchanged status.
+func (c *Client) WaitStatus(ctx context.Context, etag string, timeout time.Duration) (*StateXML, error) {
+	var state StateXML
+	if err := c.longPoll(ctx, "/Status", etag, timeout, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// WaitVolume long-polls /Volume the same way WaitStatus does for /Status
+func (c *Client) WaitVolume(ctx context.Context, etag string, timeout time.Duration) (*VolumeStatus, error) {
+	var vol VolumeStatus
+	if err := c.longPoll(ctx, "/Volume", etag, timeout, &vol); err != nil {
+		return nil, err
+	}
+	return &vol, nil
+}
+
+// longPoll issues a single ?timeout=&etag= request. The request timeout is
+// extended by the client timeout so the player has time to answer.
+func (c *Client) longPoll(ctx context.Context, path, etag string, timeout time.Duration, v any) error {
+	query := url.Values{"timeout": {strconv.Itoa(int(timeout.Seconds()))}}
+	if etag != "" {
+		query.Set("etag", etag)
+	}
+
+	data, err := c.get(ctx, path, query, timeout+c.Timeout, c.Retries)
+	if err != nil {
+		return err
+	}
+	return decodeXML(c.URL(path, query), data, v)
+}
+
+// Watch long-polls /Status and /Volume until ctx is done. The current state of
+// each is sent first, then an event only when its etag changes. Polling errors
+// are sent as events and retried after a back-off. The channel is closed when
+// ctx is done.
+func (c *Client) Watch(ctx context.Context, pollTimeout time.Duration) <-chan Event {
+	events := make(chan Event, 4)
+	var wg sync.WaitGroup
+
+	wg.Go(func() {
+		c.watchLoop(ctx, events, StatusChanged, func(etag string) (string, Event, error) {
+			state, err := c.WaitStatus(ctx, etag, pollTimeout)
+			if err != nil {
+				return "", Event{}, err
+			}
+			return state.Etag, Event{Type: StatusChanged, Status: state}, nil
+		})
+	})
+	wg.Go(func() {
+		c.watchLoop(ctx, events, VolumeChanged, func(etag string) (string, Event, error) {
+			vol, err := c.WaitVolume(ctx, etag, pollTimeout)
+			if err != nil {
+				return "", Event{}, err
+			}
+			return vol.Etag, Event{Type: VolumeChanged, Volume: vol}, nil
+		})
+	})
+
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+
+	return events
+}
+
+// watchLoop repeatedly calls poll with the last seen etag and forwards changes
+func (c *Client) watchLoop(ctx context.Context, events chan<- Event, kind EventType, poll func(etag string) (string, Event, error)) {
+	const maxBackoff = 30 * time.Second
+	backoff := time.Second
+	etag := ""
+
+	for ctx.Err() == nil {
+		newEtag, ev, err := poll(etag)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			c.logf("Long-poll failed, retrying in %v: %v", backoff, err)
+			if !send(ctx, events, Event{Type: kind, Err: err}) {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxBackoff)
+			// Force a fresh event once the player answers again
+			etag = ""
+			continue
+		}
+		backoff = time.Second
+
+		if newEtag == etag && etag != "" {
+			// Long-poll timed out without a change
+			continue
+		}
+		etag = newEtag
+		if !send(ctx, events, ev) {
+			return
+		}
+
+		if etag == "" {
+			// No etag means the request cannot block; fall back to plain polling
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}
+}
+
+// send delivers an event unless ctx is done first
+func send(ctx context.Context, events chan<- Event, ev Event) bool {
+	select {
+	case events <- ev:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"BlueOS/bluos"
+	"github.com/johnmccabe/go-bitbar"
+)
+
+const (
+	browseCacheTTL        = time.Hour       // How long a fetched browse tree is reused
+	browsePartialCacheTTL = 5 * time.Minute // How long a tree with missing levels is reused
+	browseDefaultDepth    = 2               // Levels shown in the Browse submenu without BLUE_BROWSE_DEPTH
+	browseMaxDepth        = 3               // Deeper trees need too many requests per refresh
+	browseMaxItems        = 30              // Items kept per level
+	browseMaxRequests     = 4               // /Browse requests in flight at once, to spare the player
+)
+
+// browseNode is a /Browse item with the levels below it, fetched down to the
+// configured depth
+type browseNode struct {
+	ID       string           `json:"id,omitempty"` // Set on playable items, used by menu commands
+	Item     bluos.BrowseItem `json:"item"`
+	Children []browseNode     `json:"children,omitempty"`
+}
+
+// browseCache stores the browse tree of one player
+type browseCache struct {
+	URL       string       `json:"url"`
+	Depth     int          `json:"depth"`
+	Partial   bool         `json:"partial,omitempty"` // Some levels failed or were cut short by the deadline
+	UpdatedAt time.Time    `json:"updatedAt"`
+	Nodes     []browseNode `json:"nodes"`
+}
+
+// fresh reports whether the cached tree can still be used. A partial tree is
+// kept briefly, so refreshes do not all start the full walk again.
+func (c *browseCache) fresh(depth int) bool {
+	ttl := browseCacheTTL
+	if c.Partial {
+		ttl = browsePartialCacheTTL
+	}
+	return c.Depth == depth && time.Since(c.UpdatedAt) < ttl
+}
+
+// browseCachePath returns the location of the browse tree cache
+func browseCachePath() string {
+	return tmpPath("blueos-browse.json")
+}
+
+// browseDepth returns how many levels the Browse submenu shows, set with
+// BLUE_BROWSE_DEPTH in .env; 0 hides the submenu
+func browseDepth() int {
+	depth, err := strconv.Atoi(myConfig["BLUE_BROWSE_DEPTH"])
+	if err != nil {
+		return browseDefaultDepth
+	}
+	return max(0, min(depth, browseMaxDepth))
+}
+
+// browseItemID identifies a playable item by what it plays, so menu commands
+// do not have to pass the player's URLs as parameters
+func browseItemID(item bluos.BrowseItem) string {
+	sum := sha256.Sum256([]byte(item.PlayURL + "\n" + item.AutoplayURL))
+	return fmt.Sprintf("%x", sum[:6])
+}
+
+// readBrowseCache returns the cached browse tree of a player regardless of its age
+func readBrowseCache(playerURL string) (*browseCache, error) {
+	data, err := os.ReadFile(browseCachePath())
+	if err != nil {
+		return nil, err
+	}
+	var cache browseCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, err
+	}
+	if cache.URL != playerURL {
+		return nil, fmt.Errorf("browse cache belongs to %s", cache.URL)
+	}
+	return &cache, nil
+}
+
+// loadBrowse returns the browse tree down to browseDepth levels. The tree is
+// cached for browseCacheTTL since walking it takes a request per level.
+func loadBrowse(ctx context.Context, client *bluos.Client) ([]browseNode, error) {
+	depth := browseDepth()
+	if depth == 0 {
+		return nil, nil
+	}
+
+	if cache, err := readBrowseCache(client.BaseURL); err == nil && cache.fresh(depth) {
+		log.Printf("Using cached browse tree")
+		return cache.Nodes, nil
+	}
+
+	log.Printf("Fetching browse tree, %d levels", depth)
+	walk := &browseWalk{client: client, sem: make(chan struct{}, browseMaxRequests)}
+	nodes, err := walk.fetchLevel(ctx, "", depth)
+	if err != nil {
+		return nil, err
+	}
+
+	partial := walk.partial.Load() || ctx.Err() != nil
+	data, err := json.Marshal(browseCache{URL: client.BaseURL, Depth: depth, Partial: partial, UpdatedAt: time.Now(), Nodes: nodes})
+	if err == nil {
+		err = os.WriteFile(browseCachePath(), data, 0o600)
+	}
+	if err != nil {
+		log.Printf("Failed to cache browse tree: %v", err)
+	}
+	return nodes, nil
+}
+
+// browseWalk fetches a browse tree with at most browseMaxRequests requests
+// in flight
+type browseWalk struct {
+	client  *bluos.Client
+	sem     chan struct{}
+	partial atomic.Bool // Set when a level could not be fetched
+}
+
+// browse fetches one level once a request slot is free
+func (w *browseWalk) browse(ctx context.Context, key string) (*bluos.BrowseResult, error) {
+	select {
+	case w.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-w.sem }()
+	return w.client.Browse(ctx, key)
+}
+
+// fetchLevel fetches the level at key and, while depth allows, the levels
+// below it concurrently. Failing sublevels are left empty.
+func (w *browseWalk) fetchLevel(ctx context.Context, key string, depth int) ([]browseNode, error) {
+	result, err := w.browse(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []browseNode
+	for _, item := range result.AllItems() {
+		if item.BrowseKey == "" && !item.Playable() {
+			continue // Headings and notices
+		}
+		node := browseNode{Item: item}
+		if item.Playable() {
+			node.ID = browseItemID(item)
+		}
+		nodes = append(nodes, node)
+		if len(nodes) == browseMaxItems {
+			break
+		}
+	}
+
+	if depth > 1 {
+		var wg sync.WaitGroup
+		for i := range nodes {
+			if nodes[i].Item.BrowseKey == "" {
+				continue
+			}
+			wg.Go(func() {
+				children, err := w.fetchLevel(ctx, nodes[i].Item.BrowseKey, depth-1)
+				if err != nil {
+					log.Printf("Could not browse %s: %v", nodes[i].Item.Text, err)
+					w.partial.Store(true)
+					return
+				}
+				nodes[i].Children = children
+			})
+		}
+		wg.Wait()
+	}
+	return nodes, nil
+}
+
+// findBrowseNode returns the node with id anywhere in the tree
+func findBrowseNode(nodes []browseNode, id string) *browseNode {
+	for i := range nodes {
+		if nodes[i].ID == id {
+			return &nodes[i]
+		}
+		if found := findBrowseNode(nodes[i].Children, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// browseLabel returns the menu text of an item, with its subtitle when it has one
+func browseLabel(item bluos.BrowseItem) string {
+	if item.Text2 != "" {
+		return item.Text + " – " + item.Text2
+	}
+	return item.Text
+}
+
+// addBrowseMenu adds a Browse submenu with the services, inputs and library
+// of the player. Levels open as nested submenus; playable items play on click.
+func addBrowseMenu(submenu *bitbar.SubMenu, client *bluos.Client, nodes []browseNode) {
+	if len(nodes) == 0 {
+		return
+	}
+	submenu.Line(":square.grid.2x2: Browse")
+	addBrowseNodes(submenu.NewSubMenu(), client, nodes)
+}
+
+// addBrowseNodes adds one browse level to menu
+func addBrowseNodes(menu *bitbar.SubMenu, client *bluos.Client, nodes []browseNode) {
+	for _, node := range nodes {
+		label := browseLabel(node.Item)
+		switch {
+		case len(node.Children) > 0:
+			menu.Line(label).Length(MAX)
+			children := menu.NewSubMenu()
+			// A line with a submenu cannot be clicked, so albums and
+			// playlists get their own play line
+			if node.ID != "" {
+				children.Line(":play.fill: Play all").Command(createCommand(client, "browse", "play", node.ID))
+				children.Line("---")
+			}
+			addBrowseNodes(children, client, node.Children)
+		case node.ID != "":
+			menu.Line(label).Length(MAX).Command(createCommand(client, "browse", "play", node.ID))
+		default:
+			// Below the configured depth
+			menu.Line(label).Length(MAX).Color("gray")
+		}
+	}
+}
+
+// browseEntry is an item in the output of the browse command
+type browseEntry struct {
+	Name     string `json:"name"`
+	Type     string `json:"type,omitempty"`
+	Playable bool   `json:"playable"`
+	Browse   bool   `json:"browse"` // The item leads to another level
+}
+
+// browseList is the output of the browse command for one level
+type browseList struct {
+	Path  []string      `json:"path"`
+	Items []browseEntry `json:"items"`
+}
+
+func (l browseList) String() string {
+	if len(l.Items) == 0 {
+		return "Nothing to browse"
+	}
+	lines := make([]string, len(l.Items))
+	for i, e := range l.Items {
+		marker := " "
+		switch {
+		case e.Browse:
+			marker = ">"
+		case e.Playable:
+			marker = "▶"
+		}
+		lines[i] = fmt.Sprintf("%s %s", marker, e.Name)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// cmdBrowse lists a browse level reached by item names, or plays an item.
+// Menu items play by the id of an item in the cached tree.
+func cmdBrowse(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	if len(args) > 0 && args[0] == "play" {
+		if len(args) == 1 {
+			return nil, errors.New("usage: browse play <id | name...>")
+		}
+		if len(args) == 2 {
+			if cache, err := readBrowseCache(client.BaseURL); err == nil {
+				if node := findBrowseNode(cache.Nodes, args[1]); node != nil {
+					return playBrowseItem(ctx, client, node.Item)
+				}
+			}
+		}
+		item, err := walkBrowse(ctx, client, args[1:])
+		if err != nil {
+			return nil, err
+		}
+		return playBrowseItem(ctx, client, *item)
+	}
+
+	key := ""
+	if len(args) > 0 {
+		item, err := walkBrowse(ctx, client, args)
+		if err != nil {
+			return nil, err
+		}
+		if item.BrowseKey == "" {
+			// Naming a track or station plays it
+			return playBrowseItem(ctx, client, *item)
+		}
+		key = item.BrowseKey
+	}
+	result, err := client.Browse(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	list := browseList{Path: args, Items: []browseEntry{}}
+	for _, item := range result.AllItems() {
+		list.Items = append(list.Items, browseEntry{Name: browseLabel(item), Type: item.Type, Playable: item.Playable(), Browse: item.BrowseKey != ""})
+	}
+	return list, nil
+}
+
+// playBrowseItem plays an item and confirms it
+func playBrowseItem(ctx context.Context, client *bluos.Client, item bluos.BrowseItem) (any, error) {
+	if err := client.PlayItem(ctx, item); err != nil {
+		return nil, err
+	}
+	return messageResult{fmt.Sprintf("Playing %s", item.Text)}, nil
+}
+
+// walkBrowse follows item names from the top level and returns the last item
+func walkBrowse(ctx context.Context, client *bluos.Client, names []string) (*bluos.BrowseItem, error) {
+	key := ""
+	var item *bluos.BrowseItem
+	for i, name := range names {
+		if i > 0 && item.BrowseKey == "" {
+			return nil, fmt.Errorf("%q has nothing to browse", item.Text)
+		}
+		result, err := client.Browse(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if item, err = findBrowseItem(result.AllItems(), name); err != nil {
+			return nil, err
+		}
+		key = item.BrowseKey
+	}
+	return item, nil
+}
+
+// findBrowseItem finds an item by exact name, or by a part of it when that is unique
+func findBrowseItem(items []bluos.BrowseItem, query string) (*bluos.BrowseItem, error) {
+	i, err := findByName(items, "item", func(item bluos.BrowseItem) string { return item.Text }, query)
+	if err != nil {
+		return nil, err
+	}
+	return &items[i], nil
+}
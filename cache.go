@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DiscoveryCache remembers the last verified player so refreshes can skip mDNS
+type DiscoveryCache struct {
+	URL          string    `json:"url"`
+	Name         string    `json:"name,omitempty"`
+	Model        string    `json:"model,omitempty"`
+	Network      string    `json:"network"` // Local networks the device was verified on
+	LastVerified time.Time `json:"lastVerified"`
+}
+
+// discoveryCachePath returns the location of the discovery cache file
+func discoveryCachePath() string {
+	return tmpPath("blueos-discovery.json")
+}
+
+// loadDiscoveryCache reads the discovery cache from TMPDIR
+func loadDiscoveryCache() (*DiscoveryCache, error) {
+	data, err := os.ReadFile(discoveryCachePath())
+	if err != nil {
+		return nil, err
+	}
+
+	var cache DiscoveryCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, err
+	}
+	return &cache, nil
+}
+
+// saveDiscoveryCache writes the discovery cache to TMPDIR
+func saveDiscoveryCache(cache *DiscoveryCache) {
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode discovery cache: %v", err)
+		return
+	}
+	if err := os.WriteFile(discoveryCachePath(), data, 0o600); err != nil {
+		log.Printf("Failed to write discovery cache: %v", err)
+	}
+}
+
+// invalidateDiscoveryCache removes the discovery cache
+func invalidateDiscoveryCache() {
+	if err := os.Remove(discoveryCachePath()); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove discovery cache: %v", err)
+	}
+}
+
+// cachedBluOSDevice returns the cached device URL if it was verified on the
+// current network, has the wanted name (when set) and still answers /Status
+func cachedBluOSDevice(ctx context.Context, network, name string) (string, bool) {
+	cache, err := loadDiscoveryCache()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Ignoring unreadable discovery cache: %v", err)
+		}
+		return "", false
+	}
+
+	if cache.Network != network {
+		log.Printf("Network changed since %s was cached, invalidating", cache.URL)
+		invalidateDiscoveryCache()
+		return "", false
+	}
+
+	if name != "" && !strings.EqualFold(cache.Name, name) {
+		log.Printf("Cached device %s is %q, looking for %q", cache.URL, cache.Name, name)
+		return "", false
+	}
+
+	if err := verifyDevice(ctx, cache.URL); err != nil {
+		log.Printf("Cached device %s failed verification: %v", cache.URL, err)
+		return "", false
+	}
+
+	log.Printf("Using cached BluOS device: %s (name: %q, model: %q)", cache.URL, cache.Name, cache.Model)
+	cache.LastVerified = time.Now()
+	saveDiscoveryCache(cache)
+	return cache.URL, true
+}
+
+// rememberDevice caches a verified device together with its name and model
+func rememberDevice(ctx context.Context, deviceURL, network string) {
+	cache := &DiscoveryCache{URL: deviceURL, Network: network, LastVerified: time.Now()}
+
+	// Name and model are informational, so a failure here is not fatal
+	if sync, err := newProbeClient(deviceURL).SyncStatus(ctx); err == nil {
+		cache.Name = sync.Name
+		cache.Model = sync.ModelName
+		if cache.Model == "" {
+			cache.Model = sync.Model
+		}
+	} else {
+		log.Printf("Could not read name and model of %s: %v", deviceURL, err)
+	}
+
+	saveDiscoveryCache(cache)
+}
+
+// currentNetworkID identifies the local networks this machine is attached to,
+// so a cached device is not trusted after moving to another network
+func currentNetworkID() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		log.Printf("Failed to list interface addresses: %v", err)
+		return ""
+	}
+
+	var networks []string
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.To4() == nil {
+			continue
+		}
+		networks = append(networks, (&net.IPNet{IP: ipNet.IP.Mask(ipNet.Mask), Mask: ipNet.Mask}).String())
+	}
+	sort.Strings(networks)
+	return strings.Join(networks, ",")
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"BlueOS/bluos"
+)
+
+// cliCommands are the commands that only exist on the command line, in
+// addition to everything in playerCommands
+var cliCommands = map[string]string{
+	"devices": "devices",
+	"watch":   "watch",
+}
+
+// isCLICommand reports whether name is a scriptable CLI command
+func isCLICommand(name string) bool {
+	_, player := playerCommands[name]
+	_, cli := cliCommands[name]
+	// Global flags such as --json or --url=... come before the command
+	return player || cli || name == "help" || strings.HasPrefix(name, "-")
+}
+
+// cliOptions are the global flags shared by all CLI commands
+type cliOptions struct {
+	json      bool
+	playerURL string
+}
+
+// runCLI executes a scriptable CLI invocation and returns the process exit code
+func runCLI(args []string) int {
+	// --json may appear anywhere so it can be appended to any command
+	var opts cliOptions
+	if i := slices.Index(args, "--json"); i >= 0 {
+		opts.json = true
+		args = slices.Delete(slices.Clone(args), i, i+1)
+	}
+
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	fs.StringVar(&opts.playerURL, "url", "", "player URL (discovered when empty)")
+	fs.Usage = printCLIUsage
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 || fs.Arg(0) == "help" {
+		printCLIUsage()
+		return 2
+	}
+	name, cmdArgs := fs.Arg(0), fs.Args()[1:]
+
+	var (
+		result any
+		err    error
+	)
+	switch name {
+	case "devices":
+		result, err = cliDevices()
+	case "watch":
+		err = cliWatch(opts)
+	default:
+		command, ok := playerCommands[name]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+			printCLIUsage()
+			return 2
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), DEADLINE)
+		defer cancel()
+		if interruptsFade(name, cmdArgs) {
+			interruptFade(ctx)
+		}
+		result, err = runPlayerCommand(ctx, opts.playerURL, command, cmdArgs)
+	}
+
+	// A command may report what it did before failing, e.g. the steps of a scene
+	if result != nil {
+		printResult(opts, result)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+// printResult writes a command result as indented JSON or human-readable text
+func printResult(opts cliOptions, result any) {
+	if opts.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+		return
+	}
+	fmt.Println(result)
+}
+
+// printCLIUsage lists the CLI commands on stderr
+func printCLIUsage() {
+	var usages []string
+	for _, command := range playerCommands {
+		usages = append(usages, command.usage)
+	}
+	for _, usage := range cliCommands {
+		usages = append(usages, usage)
+	}
+	sort.Strings(usages)
+
+	fmt.Fprintf(os.Stderr, "usage: %s [--url URL] [--json] <command> [args]\n\ncommands:\n", filepath.Base(os.Args[0]))
+	for _, usage := range usages {
+		fmt.Fprintf(os.Stderr, "  %s\n", usage)
+	}
+}
+
+// deviceInfo describes a discovered player
+type deviceInfo struct {
+	URL    string `json:"url"`
+	Name   string `json:"name,omitempty"`
+	Model  string `json:"model,omitempty"`
+	Active bool   `json:"active"` // The player the menu currently uses
+}
+
+// deviceList is the output of the devices command
+type deviceList []deviceInfo
+
+func (l deviceList) String() string {
+	if len(l) == 0 {
+		return "No BluOS devices found"
+	}
+	lines := make([]string, len(l))
+	for i, d := range l {
+		marker := " "
+		if d.Active {
+			marker = "*"
+		}
+		lines[i] = fmt.Sprintf("%s %-20s %-12s %s", marker, d.Name, d.Model, d.URL)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// cliDevices discovers all players and reads their names and models
+func cliDevices() (any, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DEADLINE+5*time.Second)
+	defer cancel()
+
+	urls, err := discoverBluOSDevices(ctx, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	active := ""
+	if cache, err := loadDiscoveryCache(); err == nil {
+		active = cache.URL
+	}
+
+	devices := make(deviceList, 0, len(urls))
+	for _, u := range urls {
+		d := deviceInfo{URL: u, Active: u == active}
+		if sync, err := newProbeClient(u).SyncStatus(ctx); err == nil {
+			d.Name = sync.Name
+			d.Model = cmp.Or(sync.ModelName, sync.Model)
+		}
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+// watchEvent is one line of watch output
+type watchEvent struct {
+	Time   time.Time           `json:"time"`
+	Type   string              `json:"type"`
+	Status *bluos.StateXML     `json:"status,omitempty"`
+	Volume *bluos.VolumeStatus `json:"volume,omitempty"`
+	Error  string              `json:"error,omitempty"`
+}
+
+func (e watchEvent) String() string {
+	ts := e.Time.Format("15:04:05")
+	switch {
+	case e.Error != "":
+		return fmt.Sprintf("[%s] %s error: %s", ts, e.Type, e.Error)
+	case e.Status != nil:
+		return fmt.Sprintf("[%s] %s: %s - %s (%s)", ts, e.Status.State, e.Status.Title1, e.Status.Title2, e.Status.ServiceName)
+	default:
+		return fmt.Sprintf("[%s] %s", ts, volumeResult{e.Volume})
+	}
+}
+
+// cliWatch prints status and volume changes until interrupted. With --json
+// every change is written as one JSON object per line.
+func cliWatch(opts cliOptions) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	playerURL := opts.playerURL
+	if playerURL == "" {
+		var err error
+		if playerURL, err = getBluOSPlayerURL(ctx, myConfig["BLUE_URL"]); err != nil {
+			return err
+		}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for ev := range bluos.NewClient(playerURL).Watch(ctx, bluos.DefaultPollTimeout) {
+		out := watchEvent{Time: time.Now(), Type: "status", Status: ev.Status, Volume: ev.Volume}
+		if ev.Type == bluos.VolumeChanged {
+			out.Type = "volume"
+		}
+		if ev.Err != nil {
+			out.Error = ev.Err.Error()
+		}
+
+		if opts.json {
+			if err := enc.Encode(out); err != nil {
+				return err
+			}
+		} else {
+			fmt.Println(out)
+		}
+	}
+	return nil
+}
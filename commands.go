@@ -0,0 +1,559 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"BlueOS/bluos"
+	"github.com/johnmccabe/go-bitbar"
+)
+
+// playerCommand is an action the menu triggers by re-invoking this binary in
+// command mode, e.g. blueos.10s.gobin cmd --url http://... volume --db -1
+type playerCommand struct {
+	usage string
+	run   func(ctx context.Context, client *bluos.Client, args []string) (any, error)
+}
+
+// playerCommands lists every action available in command mode
+var playerCommands = map[string]playerCommand{
+	"status":    {"status", cmdStatus},
+	"play":      {"play", cmdPlay},
+	"pause":     {"pause", cmdPause},
+	"toggle":    {"toggle", cmdToggle},
+	"stop":      {"stop", cmdStop},
+	"preset":    {"preset <id|name|next|prev>", cmdPreset},
+	"volume":    {"volume <level|+db|-db|undo>", cmdVolume},
+	"skip":      {"skip", cmdSkip},
+	"back":      {"back", cmdBack},
+	"seek":      {"seek <secs|+secs|-secs|percent%>", cmdSeek},
+	"shuffle":   {"shuffle [on|off|toggle]", cmdShuffle},
+	"repeat":    {"repeat [off|all|one|cycle]", cmdRepeat},
+	"queue":     {"queue [list | play <n> | delete <n> | move <from> <to> | clear]", cmdQueue},
+	"group":     {"group [list | add <room> | remove <room> | ungroup]", cmdGroup},
+	"player":    {"player [list | <room>]", cmdPlayer},
+	"move":      {"move <room>", cmdMove},
+	"action":    {"action [<name>]", cmdAction},
+	"sleep":     {"sleep [<minutes> | fade <minutes> | off]", cmdSleep},
+	"browse":    {"browse [<name>...] | browse play <id | name...>", cmdBrowse},
+	"favourite": {"favourite [list | play <n|name|url> | add [<name>] | remove <n|name>]", cmdFavourite},
+	"fade":      {"fade [--secs <n>] out | in | preset <id|name>", cmdFade},
+	"alarm":     {"alarm [list | enable <n|name> | disable <n|name>]", cmdAlarm},
+	"scene":     {"scene [list | <n|name>]", cmdScene},
+	"search":    {"search [--service <name>] <query> | search play|add <n> | search clear", cmdSearch},
+	"mute":      {"mute", cmdMute},
+	"unmute":    {"unmute", cmdUnmute},
+}
+
+// executablePath returns the path of the running binary so menu items can invoke it
+var executablePath = sync.OnceValue(func() string {
+	path, err := os.Executable()
+	if err != nil {
+		log.Printf("Failed to resolve executable path: %v", err)
+		return os.Args[0]
+	}
+	return path
+})
+
+// createCommand creates a bitbar command that re-invokes this binary in command mode
+func createCommand(client *bluos.Client, args ...string) bitbar.Cmd {
+	params := append([]string{"cmd", "--url", client.BaseURL}, args...)
+	return bitbar.Cmd{
+		Bash:     executablePath(),
+		Params:   params,
+		Terminal: BoolPointer(false),
+		Refresh:  BoolPointer(true),
+	}
+}
+
+// runCommand executes a command-mode invocation and returns the process exit code.
+// Failures are recorded so the next menu render can show them.
+func runCommand(args []string) int {
+	fs := flag.NewFlagSet("cmd", flag.ContinueOnError)
+	playerURL := fs.String("url", "", "player URL (discovered when empty)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		printCommandUsage()
+		return 2
+	}
+
+	name, cmdArgs := fs.Arg(0), fs.Args()[1:]
+	if name == "dismiss" {
+		clearCommandFailures()
+		return 0
+	}
+	if name == "sleep-worker" {
+		return runSleepWorker(*playerURL)
+	}
+	if name == "fade-worker" {
+		return runFadeWorker(*playerURL)
+	}
+
+	command, ok := playerCommands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+		printCommandUsage()
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DEADLINE)
+	defer cancel()
+
+	if interruptsFade(name, cmdArgs) {
+		interruptFade(ctx)
+	}
+	if _, err := runPlayerCommand(ctx, *playerURL, command, cmdArgs); err != nil {
+		log.Printf("Command %q failed: %v", strings.Join(fs.Args(), " "), err)
+		recordCommandFailure(strings.Join(fs.Args(), " "), err)
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// runPlayerCommand resolves the player when no URL is given and runs the command
+func runPlayerCommand(ctx context.Context, playerURL string, command playerCommand, args []string) (any, error) {
+	if playerURL == "" {
+		var err error
+		if playerURL, err = getBluOSPlayerURL(ctx, myConfig["BLUE_URL"]); err != nil {
+			return nil, err
+		}
+	}
+	return command.run(ctx, bluos.NewClient(playerURL), args)
+}
+
+// printCommandUsage lists the available commands on stderr
+func printCommandUsage() {
+	names := make([]string, 0, len(playerCommands))
+	for name := range playerCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage: cmd [--url URL] <command> [args]")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", playerCommands[name].usage)
+	}
+	fmt.Fprintln(os.Stderr, "  dismiss")
+}
+
+// stateResult is the player state reported by playback commands
+type stateResult struct {
+	State string `json:"state"`
+}
+
+func (r stateResult) String() string {
+	return fmt.Sprintf("State: %s", r.State)
+}
+
+// volumeResult is the volume reported by volume commands
+type volumeResult struct {
+	*bluos.VolumeStatus
+}
+
+func (r volumeResult) String() string {
+	muted := ""
+	if r.Mute == 1 {
+		muted = " (Muted)"
+	}
+	return fmt.Sprintf("Volume: %d%% (%.1f dB)%s", r.Level, r.Db, muted)
+}
+
+// statusResult is the combined output of the status command
+type statusResult struct {
+	Status *bluos.StateXML     `json:"status"`
+	Volume *bluos.VolumeStatus `json:"volume,omitempty"`
+}
+
+func (r statusResult) String() string {
+	s := r.Status
+	var b strings.Builder
+	fmt.Fprintf(&b, "State:   %s\n", s.State)
+	if s.ServiceName != "" {
+		fmt.Fprintf(&b, "Service: %s\n", s.ServiceName)
+	}
+	for _, title := range []string{s.Title1, s.Title2, s.Title3} {
+		if title != "" {
+			fmt.Fprintf(&b, "Title:   %s\n", title)
+		}
+	}
+	if s.Quality != "" {
+		fmt.Fprintf(&b, "Quality: %s\n", s.Quality)
+	}
+	if r.Volume != nil {
+		fmt.Fprintf(&b, "%s\n", volumeResult{r.Volume})
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// presetResult identifies the preset a command started
+type presetResult struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func (r presetResult) String() string {
+	return fmt.Sprintf("Playing preset %s - %s", r.ID, r.Name)
+}
+
+func cmdStatus(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	status, err := client.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Volume is informational here, so a failure only omits it
+	vol, err := client.Volume(ctx)
+	if err != nil {
+		log.Printf("Failed to get volume: %v", err)
+	}
+	return statusResult{Status: status, Volume: vol}, nil
+}
+
+func cmdPlay(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	return stateCommand(client.Play(ctx))
+}
+
+func cmdPause(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	return stateCommand(client.Pause(ctx))
+}
+
+func cmdToggle(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	return stateCommand(client.TogglePause(ctx))
+}
+
+func cmdStop(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	return stateCommand(client.Stop(ctx))
+}
+
+// stateCommand wraps the result of a playback call
+func stateCommand(state string, err error) (any, error) {
+	if err != nil {
+		return nil, err
+	}
+	return stateResult{State: state}, nil
+}
+
+// messageResult is a short confirmation for commands without a richer result
+type messageResult struct {
+	Message string `json:"message"`
+}
+
+func (r messageResult) String() string {
+	return r.Message
+}
+
+// messageCommand wraps a confirmation message for a call that only returns an error
+func messageCommand(message string, err error) (any, error) {
+	if err != nil {
+		return nil, err
+	}
+	return messageResult{message}, nil
+}
+
+func cmdSkip(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	return messageCommand("Skipped to next track", client.Skip(ctx))
+}
+
+func cmdBack(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	return messageCommand("Went back", client.Back(ctx))
+}
+
+func cmdSeek(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	if len(args) != 1 {
+		return nil, errors.New("usage: seek <secs|+secs|-secs|percent%>")
+	}
+
+	status, err := client.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if status.CanSeek != "1" {
+		return nil, errors.New("the current track cannot be seeked")
+	}
+	secs, err := parseSeekArg(args[0], status)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := client.Seek(ctx, secs); err != nil {
+		return nil, err
+	}
+	return messageResult{fmt.Sprintf("Seeked to %s", formatDuration(secs))}, nil
+}
+
+// parseSeekArg converts an absolute position (90), a relative jump (+30, -30)
+// or a percentage of the track (50%) into seconds, clamped to the track length
+func parseSeekArg(arg string, status *bluos.StateXML) (int, error) {
+	current, _ := strconv.Atoi(status.Secs)
+	total, _ := strconv.Atoi(status.Totlen)
+
+	var secs int
+	switch {
+	case strings.HasSuffix(arg, "%"):
+		pct, err := strconv.ParseFloat(strings.TrimSuffix(arg, "%"), 64)
+		if err != nil || pct < 0 || pct > 100 {
+			return 0, fmt.Errorf("invalid percentage %q", arg)
+		}
+		if total == 0 {
+			return 0, errors.New("track length unknown, cannot seek by percentage")
+		}
+		secs = int(float64(total) * pct / 100)
+	case strings.HasPrefix(arg, "+"), strings.HasPrefix(arg, "-"):
+		delta, err := strconv.Atoi(arg)
+		if err != nil {
+			return 0, fmt.Errorf("invalid seek offset %q", arg)
+		}
+		secs = current + delta
+	default:
+		abs, err := strconv.Atoi(arg)
+		if err != nil {
+			return 0, fmt.Errorf("invalid seek position %q", arg)
+		}
+		secs = abs
+	}
+
+	secs = max(secs, 0)
+	if total > 0 {
+		secs = min(secs, total-1)
+	}
+	return secs, nil
+}
+
+// formatDuration formats seconds as m:ss or h:mm:ss
+func formatDuration(secs int) string {
+	if secs >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", secs/3600, secs%3600/60, secs%60)
+	}
+	return fmt.Sprintf("%d:%02d", secs/60, secs%60)
+}
+
+func cmdShuffle(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	mode := "toggle"
+	if len(args) > 0 {
+		mode = args[0]
+	}
+
+	var on bool
+	switch mode {
+	case "on":
+		on = true
+	case "off":
+		on = false
+	case "toggle":
+		status, err := client.Status(ctx)
+		if err != nil {
+			return nil, err
+		}
+		on = status.Shuffle != "1"
+	default:
+		return nil, errors.New("usage: shuffle [on|off|toggle]")
+	}
+
+	if err := client.SetShuffle(ctx, on); err != nil {
+		return nil, err
+	}
+	if on {
+		return messageResult{"Shuffle: on"}, nil
+	}
+	return messageResult{"Shuffle: off"}, nil
+}
+
+func cmdRepeat(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	mode := "cycle"
+	if len(args) > 0 {
+		mode = args[0]
+	}
+
+	var repeat bluos.RepeatMode
+	switch mode {
+	case "off":
+		repeat = bluos.RepeatOff
+	case "all":
+		repeat = bluos.RepeatAll
+	case "one":
+		repeat = bluos.RepeatOne
+	case "cycle":
+		status, err := client.Status(ctx)
+		if err != nil {
+			return nil, err
+		}
+		repeat = nextRepeatMode(bluos.ParseRepeatMode(status.Repeat))
+	default:
+		return nil, errors.New("usage: repeat [off|all|one|cycle]")
+	}
+
+	if err := client.SetRepeat(ctx, repeat); err != nil {
+		return nil, err
+	}
+	return messageResult{fmt.Sprintf("Repeat: %s", repeat)}, nil
+}
+
+// nextRepeatMode cycles off -> all -> one -> off
+func nextRepeatMode(mode bluos.RepeatMode) bluos.RepeatMode {
+	switch mode {
+	case bluos.RepeatOff:
+		return bluos.RepeatAll
+	case bluos.RepeatAll:
+		return bluos.RepeatOne
+	default:
+		return bluos.RepeatOff
+	}
+}
+
+// cmdPreset starts a preset by id or name, or the next or previous one
+func cmdPreset(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	if len(args) == 0 {
+		return nil, errors.New("usage: preset <id|name|next|prev>")
+	}
+	if len(args) == 1 {
+		switch args[0] {
+		case "next":
+			return stepPreset(ctx, client, 1)
+		case "prev", "previous":
+			return stepPreset(ctx, client, -1)
+		}
+	}
+
+	presets, err := client.Presets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	preset, err := findPreset(presets, strings.Join(args, " "))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.PlayPreset(ctx, preset.ID); err != nil {
+		return nil, err
+	}
+	return presetResult{ID: preset.ID, Name: preset.Name}, nil
+}
+
+// stepPreset starts the next or previous preset and reports which one plays
+func stepPreset(ctx context.Context, client *bluos.Client, step int) (any, error) {
+	if err := client.StepPreset(ctx, step); err != nil {
+		return nil, err
+	}
+	status, err := client.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if presets, err := client.Presets(ctx); err == nil {
+		for _, p := range presets.Preset {
+			if p.ID == status.PresetID {
+				return presetResult{ID: p.ID, Name: p.Name}, nil
+			}
+		}
+	}
+	return messageResult{fmt.Sprintf("Playing %s", cmp.Or(status.Name, status.Title1))}, nil
+}
+
+// findPreset resolves a preset by id, exact name or unique name fragment
+// (case-insensitive). Fragments may be several words matched in any part of
+// the name, e.g. "soma groove" for "SomaFM Groove Salad".
+func findPreset(presets *bluos.Presets, query string) (*presetResult, error) {
+	query = strings.TrimSpace(query)
+	results := make([]presetResult, len(presets.Preset))
+	for i, p := range presets.Preset {
+		if query != "" && p.ID == query {
+			return &presetResult{ID: p.ID, Name: p.Name}, nil
+		}
+		results[i] = presetResult{ID: p.ID, Name: p.Name}
+	}
+	i, err := findByName(results, "preset", func(p presetResult) string { return p.Name }, query)
+	if err != nil {
+		return nil, err
+	}
+	return &results[i], nil
+}
+
+// cmdVolume accepts either flags (--level 40, --db -1) or a single argument:
+// a level (40), a signed dB change (+2, -1.5) or undo for the last learned volume
+func cmdVolume(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	fs := flag.NewFlagSet("volume", flag.ContinueOnError)
+	level := fs.Int("level", -1, "absolute volume level (0-100)")
+	db := fs.Float64("db", 0, "relative volume change in dB")
+
+	if len(args) == 1 && args[0] == "undo" {
+		return undoAutoVolume(ctx, client)
+	}
+
+	// A lone "-3" is a dB change, not a flag
+	if len(args) == 1 && !strings.HasPrefix(args[0], "--") {
+		var err error
+		if *level, *db, err = parseVolumeArg(args[0]); err != nil {
+			return nil, err
+		}
+	} else if err := fs.Parse(args); err != nil {
+		return nil, err
+	} else if f := fs.Lookup("level"); f.Value.String() != f.DefValue && (*level < 0 || *level > 100) {
+		return nil, fmt.Errorf("invalid volume level %q (expected 0-100)", f.Value)
+	}
+
+	var (
+		vol *bluos.VolumeStatus
+		err error
+	)
+	switch {
+	case *level >= 0:
+		vol, err = setLimitedVolume(ctx, client, *level)
+	case *db != 0:
+		vol, err = adjustLimitedVolume(ctx, client, *db)
+	default:
+		return nil, errors.New("usage: volume <level|+db|-db> | --level <0-100> | --db <delta>")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return volumeResult{vol}, nil
+}
+
+// parseVolumeArg parses "40" as a level and "+2" or "-1.5" as a dB change.
+// The unused value is returned as -1 (level) or 0 (dB).
+func parseVolumeArg(arg string) (level int, db float64, err error) {
+	if strings.HasPrefix(arg, "+") || strings.HasPrefix(arg, "-") {
+		db, err = strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return -1, 0, fmt.Errorf("invalid dB change %q", arg)
+		}
+		return -1, db, nil
+	}
+
+	level, err = strconv.Atoi(arg)
+	if err != nil || level < 0 || level > 100 {
+		return -1, 0, fmt.Errorf("invalid volume level %q (expected 0-100)", arg)
+	}
+	return level, 0, nil
+}
+
+func cmdMute(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	return volumeCommand(client.SetMute(ctx, true))
+}
+
+// cmdUnmute unmutes the player, lowering the restored level to the current limit
+func cmdUnmute(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	vol, err := client.SetMute(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return volumeCommand(enforceVolumeLimit(ctx, client, vol))
+}
+
+// volumeCommand wraps the result of a volume call
+func volumeCommand(vol *bluos.VolumeStatus, err error) (any, error) {
+	if err != nil {
+		return nil, err
+	}
+	return volumeResult{vol}, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"BlueOS/bluos"
+)
+
+func TestParseSeekArg(t *testing.T) {
+	track := &bluos.StateXML{Secs: "95", Totlen: "240"}
+	stream := &bluos.StateXML{Secs: "95"}
+
+	tests := []struct {
+		name    string
+		arg     string
+		status  *bluos.StateXML
+		want    int
+		wantErr bool
+	}{
+		{"absolute", "120", track, 120, false},
+		{"absolute past the end", "300", track, 239, false},
+		{"forward", "+30", track, 125, false},
+		{"forward past the end", "+200", track, 239, false},
+		{"back", "-30", track, 65, false},
+		{"back past the start", "-120", track, 0, false},
+		{"percentage", "50%", track, 120, false},
+		{"fractional percentage", "12.5%", track, 30, false},
+		{"start", "0%", track, 0, false},
+		{"end", "100%", track, 239, false},
+		{"percentage too large", "150%", track, 0, true},
+		{"negative percentage", "-5%", track, 0, true},
+		{"percentage without length", "50%", stream, 0, true},
+		{"absolute without length", "600", stream, 600, false},
+		{"forward without length", "+30", stream, 125, false},
+		{"invalid position", "abc", track, 0, true},
+		{"invalid offset", "+x", track, 0, true},
+		{"empty", "", track, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSeekArg(tt.arg, tt.status)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSeekArg(%q) error = %v, want error %v", tt.arg, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseSeekArg(%q) = %d, want %d", tt.arg, got, tt.want)
+			}
+		})
+	}
+}
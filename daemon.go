@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"BlueOS/bluos"
+)
+
+const (
+	daemonRetryInterval   = 30 * time.Second // Delay between discovery attempts when no player is found
+	daemonPresetsInterval = 10 * time.Minute // How often presets are refreshed without a prid change
+	daemonMaxFailures     = 3                // Consecutive unreachable polls before rediscovery
+	daemonPlayerInterval  = 2 * time.Second  // How often to check whether another player was picked
+	daemonWriteTimeout    = 2 * time.Second  // How long a client may take to read the snapshot
+)
+
+// socketPath returns the Unix socket the daemon listens on
+func socketPath() string {
+	return tmpPath("blueos.sock")
+}
+
+// readDaemonSnapshot asks a running daemon for its cached snapshot
+func readDaemonSnapshot() (*Snapshot, error) {
+	conn, err := net.DialTimeout("unix", socketPath(), 200*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(2 * time.Second)); err != nil {
+		return nil, err
+	}
+
+	var snap Snapshot
+	if err := json.NewDecoder(conn).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("decode daemon snapshot: %w", err)
+	}
+	return &snap, nil
+}
+
+// daemon owns discovery, polling and the cached snapshot served to plugin runs
+type daemon struct {
+	mu   sync.RWMutex
+	snap Snapshot
+}
+
+// runDaemon serves snapshots on the Unix socket until ctx is done
+func runDaemon(ctx context.Context) error {
+	path := socketPath()
+	// Remove a stale socket left behind by a previous run
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove stale socket: %w", err)
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("listen on %s: %w", path, err)
+	}
+	defer os.Remove(path)
+	log.Printf("Daemon listening on %s", path)
+
+	d := &daemon{}
+	go d.serve(ln)
+	go d.runAlarms(ctx)
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	d.run(ctx)
+	log.Printf("Daemon stopped")
+	return nil
+}
+
+// serve writes the current snapshot to every connection and closes it. Each
+// connection gets its own goroutine and a deadline, so a client that never
+// reads cannot hold up the others.
+func (d *daemon) serve(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go d.sendSnapshot(conn)
+	}
+}
+
+// sendSnapshot writes the current snapshot to one connection and closes it
+func (d *daemon) sendSnapshot(conn net.Conn) {
+	defer conn.Close()
+	if err := conn.SetWriteDeadline(time.Now().Add(daemonWriteTimeout)); err != nil {
+		log.Printf("Failed to set snapshot deadline: %v", err)
+		return
+	}
+	snap := d.snapshot()
+	if err := json.NewEncoder(conn).Encode(&snap); err != nil {
+		log.Printf("Failed to send snapshot: %v", err)
+	}
+}
+
+// snapshot returns a copy of the cached snapshot
+func (d *daemon) snapshot() Snapshot {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.snap
+}
+
+// update modifies the cached snapshot under the lock
+func (d *daemon) update(fn func(snap *Snapshot)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fn(&d.snap)
+	d.snap.UpdatedAt = time.Now()
+}
+
+// run discovers the player and watches it, rediscovering whenever it is lost
+func (d *daemon) run(ctx context.Context) {
+	for ctx.Err() == nil {
+		bluePlayerUrl, err := getBluOSPlayerURL(ctx, myConfig["BLUE_URL"])
+		if err != nil {
+			log.Printf("Daemon could not find a player, retrying in %v: %v", daemonRetryInterval, err)
+			d.update(func(snap *Snapshot) { *snap = Snapshot{} })
+			select {
+			case <-ctx.Done():
+			case <-time.After(daemonRetryInterval):
+			}
+			continue
+		}
+
+		client := bluos.NewClient(bluePlayerUrl)
+		fresh := fetchSnapshot(ctx, client)
+		d.update(func(snap *Snapshot) { *snap = *fresh })
+		d.watch(ctx, client)
+	}
+}
+
+// watch applies long-poll events to the snapshot until ctx is done or the
+// player stops answering
+func (d *daemon) watch(ctx context.Context, client *bluos.Client) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	log.Printf("Daemon watching %s", client.BaseURL)
+	presetsTicker := time.NewTicker(daemonPresetsInterval)
+	defer presetsTicker.Stop()
+	playerTicker := time.NewTicker(daemonPlayerInterval)
+	defer playerTicker.Stop()
+
+	failures := 0
+	events := client.Watch(ctx, bluos.DefaultPollTimeout)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-playerTicker.C:
+			// The Players submenu points the discovery cache at the new player
+			if cache, err := loadDiscoveryCache(); err == nil && cache.URL != client.BaseURL {
+				log.Printf("Player changed to %s, switching", cache.URL)
+				return
+			}
+		case <-presetsTicker.C:
+			d.refreshPresets(ctx, client)
+			d.refreshBrowse(ctx, client)
+			d.refreshArtwork(ctx, client)
+			if status := d.snapshot().Status; status != nil {
+				d.refreshRooms(ctx, client, status.SyncStat)
+			}
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if ev.Err != nil {
+				if bluos.IsUnreachable(ev.Err) {
+					failures++
+				}
+				d.applyError(ctx, ev)
+				if failures >= daemonMaxFailures {
+					log.Printf("Player %s lost, rediscovering", client.BaseURL)
+					return
+				}
+				continue
+			}
+			failures = 0
+			changed := d.applyEvent(ev)
+			if ev.Type == bluos.StatusChanged {
+				if vol := learnVolume(ctx, client, ev.Status); vol != nil {
+					d.update(func(snap *Snapshot) { snap.Volume = vol })
+				}
+			}
+			if changed.presets {
+				d.refreshPresets(ctx, client)
+			}
+			if changed.queue {
+				d.refreshQueue(ctx, client, ev.Status)
+			}
+			if changed.rooms {
+				d.refreshRooms(ctx, client, ev.Status.SyncStat)
+			}
+			if changed.artwork || changed.presets {
+				d.refreshArtwork(ctx, client)
+			}
+		}
+	}
+}
+
+// statusChanges lists the snapshot sections a status event made stale
+type statusChanges struct {
+	presets bool // Preset list id changed
+	queue   bool // Playlist id changed or the song left the fetched entries
+	rooms   bool // Sync status changed
+	artwork bool // Now-playing image changed
+}
+
+// applyEvent stores a watch event and reports which sections need a refresh
+func (d *daemon) applyEvent(ev bluos.Event) (changed statusChanges) {
+	d.update(func(snap *Snapshot) {
+		switch ev.Type {
+		case bluos.StatusChanged:
+			current, _ := strconv.Atoi(ev.Status.Song)
+			changed.presets = snap.Presets == nil || (ev.Status.Prid != "" && ev.Status.Prid != snap.Presets.Prid)
+			changed.queue = snap.Status == nil || ev.Status.Pid != snap.Status.Pid || !queueCovers(snap.Queue, current)
+			changed.rooms = snap.Status == nil || ev.Status.SyncStat != snap.Status.SyncStat
+			changed.artwork = snap.Status == nil || nowPlayingArtwork(ev.Status) != nowPlayingArtwork(snap.Status)
+			snap.Status, snap.StatusErr, snap.Reachable = ev.Status, nil, true
+			snap.StatusAt = time.Now()
+		case bluos.VolumeChanged:
+			snap.Volume, snap.VolumeErr = ev.Volume, nil
+		}
+	})
+	return changed
+}
+
+// applyError records a failed long-poll in the snapshot
+func (d *daemon) applyError(ctx context.Context, ev bluos.Event) {
+	d.update(func(snap *Snapshot) {
+		switch ev.Type {
+		case bluos.StatusChanged:
+			snap.Status, snap.StatusErr = nil, newSectionError(ev.Err)
+			snap.Reachable = !bluos.IsUnreachable(ev.Err)
+		case bluos.VolumeChanged:
+			snap.VolumeErr = newSectionError(ev.Err)
+		}
+	})
+}
+
+// refreshPresets refetches the preset list into the snapshot
+func (d *daemon) refreshPresets(ctx context.Context, client *bluos.Client) {
+	log.Printf("Daemon refreshing presets")
+	presets, err := client.Presets(ctx)
+	d.update(func(snap *Snapshot) {
+		snap.PresetsErr = newSectionError(err)
+		if err == nil {
+			snap.Presets = presets
+		}
+	})
+}
+
+// refreshQueue loads the play queue around the current song into the snapshot
+func (d *daemon) refreshQueue(ctx context.Context, client *bluos.Client, status *bluos.StateXML) {
+	log.Printf("Daemon refreshing queue for playlist %s", status.Pid)
+	queue, err := loadQueue(ctx, client, status.Pid, status.Song)
+	d.update(func(snap *Snapshot) {
+		snap.Queue, snap.QueueErr = queue, newSectionError(err)
+	})
+}
+
+// refreshRooms loads the rooms and their grouping into the snapshot
+func (d *daemon) refreshRooms(ctx context.Context, client *bluos.Client, syncStat string) {
+	log.Printf("Daemon refreshing rooms for sync status %s", syncStat)
+	rooms, err := loadRooms(ctx, client, syncStat)
+	d.update(func(snap *Snapshot) {
+		snap.RoomsErr = newSectionError(err)
+		if err == nil {
+			snap.Rooms = rooms
+		}
+	})
+}
+
+// refreshBrowse reloads the browse tree into the snapshot once its cache expires
+func (d *daemon) refreshBrowse(ctx context.Context, client *bluos.Client) {
+	nodes, err := loadBrowse(ctx, client)
+	d.update(func(snap *Snapshot) {
+		snap.BrowseErr = newSectionError(err)
+		if err == nil {
+			snap.Browse = nodes
+		}
+	})
+}
+
+// refreshArtwork downloads now-playing and preset images missing from the
+// artwork cache, which plugin runs read while rendering
+func (d *daemon) refreshArtwork(ctx context.Context, client *bluos.Client) {
+	snap := d.snapshot()
+	cacheArtwork(ctx, client, &snap)
+}
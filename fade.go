@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"BlueOS/bluos"
+	"github.com/johnmccabe/go-bitbar"
+)
+
+const (
+	fadeDefaultDuration = 4 * time.Second        // Ramp length without BLUE_FADE_SECONDS or --secs
+	fadeStepInterval    = 250 * time.Millisecond // Time between volume steps
+	fadeFloorDb         = -90.0                  // Quietest step before silence, about 3%
+)
+
+// fadeJob is a volume ramp carried out by a detached worker, like the sleep
+// with fade. Replacing or removing the file cancels the worker.
+type fadeJob struct {
+	URL      string        `json:"url"`
+	Kind     string        `json:"kind"`             // out (then pause), in (after play) or cross (to a preset)
+	Preset   string        `json:"preset,omitempty"` // Preset id of a cross-fade
+	From     int           `json:"from"`             // Level when the fade was asked for, restored after a fade-out
+	To       int           `json:"to"`               // Level a fade-in ends at
+	Duration time.Duration `json:"duration"`
+	Started  time.Time     `json:"started"`
+}
+
+// fadeJobPath returns the location of the running fade
+func fadeJobPath() string {
+	return tmpPath("blueos-fade.json")
+}
+
+// loadFadeJob returns the running fade, or nil when there is none
+func loadFadeJob() *fadeJob {
+	data, err := os.ReadFile(fadeJobPath())
+	if err != nil {
+		return nil
+	}
+	var job fadeJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		log.Printf("Ignoring unreadable fade job: %v", err)
+		return nil
+	}
+	return &job
+}
+
+// current reports whether job is still the running fade
+func (job *fadeJob) current() bool {
+	latest := loadFadeJob()
+	return latest != nil && latest.URL == job.URL && latest.Started.Equal(job.Started)
+}
+
+// fading reports whether a fade is changing the volume of a player. A job
+// left behind by a crashed worker stops counting once its time is up.
+func fading(playerURL string) bool {
+	job := loadFadeJob()
+	return job != nil && job.URL == playerURL && time.Since(job.Started) < job.Duration+5*time.Second
+}
+
+// fadeDuration returns the ramp length set with BLUE_FADE_SECONDS in .env
+func fadeDuration() time.Duration {
+	if secs, err := strconv.ParseFloat(myConfig["BLUE_FADE_SECONDS"], 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	return fadeDefaultDuration
+}
+
+// reportCommands only report something when run without arguments, so they
+// leave a running fade alone
+var reportCommands = map[string]bool{
+	"status": true, "queue": true, "group": true, "player": true, "action": true,
+	"sleep": true, "browse": true, "search": true, "favourite": true, "scene": true,
+}
+
+// interruptsFade reports whether a command cancels a running fade. Status and
+// alarm never touch playback.
+func interruptsFade(name string, args []string) bool {
+	return name != "status" && name != "alarm" && (len(args) > 0 || !reportCommands[name])
+}
+
+// interruptFade stops a running fade because another command arrived. A
+// fade that was lowering the volume gets a full level back first, so the
+// new command does not start from silence.
+func interruptFade(ctx context.Context) {
+	job := loadFadeJob()
+	if job == nil || !fading(job.URL) {
+		return
+	}
+	if err := os.Remove(fadeJobPath()); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove fade job: %v", err)
+	}
+	log.Printf("Interrupted fade %s", job.Kind)
+
+	restore := job.From
+	switch job.Kind {
+	case "in":
+		return
+	case "cross":
+		restore = job.To
+	}
+	// Let the worker see the cancellation before restoring
+	time.Sleep(fadeStepInterval)
+	if _, err := setLimitedVolume(ctx, bluos.NewClient(job.URL), restore); err != nil {
+		log.Printf("Failed to restore volume after fade: %v", err)
+	}
+}
+
+// addFadeControls adds a fade-out and pause line while playing, or a play
+// with fade-in line while paused or stopped
+func addFadeControls(submenu *bitbar.SubMenu, client *bluos.Client, state *bluos.StateXML) {
+	switch state.State {
+	case "play", "stream":
+		submenu.Line(":speaker.wave.1: Fade out and pause").Command(createCommand(client, "fade", "out"))
+	case "pause", "stop":
+		if state.Service != "" {
+			submenu.Line(":speaker.wave.3: Play with fade-in").Command(createCommand(client, "fade", "in"))
+		}
+	}
+}
+
+// cmdFade starts a fade-out then pause, a play with fade-in, or a cross-fade
+// to a preset. The ramp runs in a background worker, so the command returns
+// at once; any later command cancels it.
+func cmdFade(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	fs := flag.NewFlagSet("fade", flag.ContinueOnError)
+	secs := fs.Float64("secs", fadeDuration().Seconds(), "fade length in seconds")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() == 0 || *secs <= 0 {
+		return nil, errors.New("usage: fade [--secs <n>] out | in | preset <id|name>")
+	}
+
+	vol, err := client.Volume(ctx)
+	if err != nil {
+		return nil, err
+	}
+	limit := currentVolumeLimit(time.Now())
+	job := fadeJob{
+		URL:      client.BaseURL,
+		Kind:     fs.Arg(0),
+		From:     vol.Level,
+		To:       min(vol.Level, limit.Level),
+		Duration: time.Duration(*secs * float64(time.Second)),
+		Started:  time.Now(),
+	}
+
+	var message string
+	switch {
+	case job.Kind == "out" && fs.NArg() == 1:
+		message = fmt.Sprintf("Fading out over %.0fs", *secs)
+	case job.Kind == "in" && fs.NArg() == 1:
+		message = fmt.Sprintf("Fading in to %d%% over %.0fs", job.To, *secs)
+	case job.Kind == "preset" && fs.NArg() > 1:
+		presets, err := client.Presets(ctx)
+		if err != nil {
+			return nil, err
+		}
+		preset, err := findPreset(presets, strings.Join(fs.Args()[1:], " "))
+		if err != nil {
+			return nil, err
+		}
+		job.Kind, job.Preset = "cross", preset.ID
+		// Land on the level learned for the new preset, when there is one
+		if learned, ok := loadState().Volumes["preset:"+preset.ID]; ok && autoVolumeMax() > 0 {
+			job.To = min(learned, autoVolumeMax(), limit.Level)
+		}
+		message = fmt.Sprintf("Cross-fading to %s - %s", preset.ID, preset.Name)
+	default:
+		return nil, errors.New("usage: fade [--secs <n>] out | in | preset <id|name>")
+	}
+
+	if err := startFade(job); err != nil {
+		return nil, err
+	}
+	return messageResult{message}, nil
+}
+
+// saveFadeJob records a fade, replacing and so cancelling any running one
+func saveFadeJob(job fadeJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(fadeJobPath(), data, 0o600); err != nil {
+		return fmt.Errorf("save fade job: %w", err)
+	}
+	return nil
+}
+
+// startFade records a fade and starts its worker
+func startFade(job fadeJob) error {
+	if err := saveFadeJob(job); err != nil {
+		return err
+	}
+
+	worker := exec.Command(executablePath(), "cmd", "--url", job.URL, "fade-worker")
+	worker.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := worker.Start(); err != nil {
+		os.Remove(fadeJobPath())
+		return fmt.Errorf("start fade worker: %w", err)
+	}
+	return worker.Process.Release()
+}
+
+// runFadeWorker carries out the pending fade of a player
+func runFadeWorker(playerURL string) int {
+	job := loadFadeJob()
+	if job == nil || job.URL != playerURL {
+		log.Printf("No fade job for %s", playerURL)
+		return 1
+	}
+	if err := runFade(context.Background(), bluos.NewClient(playerURL), job); err != nil {
+		log.Printf("Fade %s failed: %v", job.Kind, err)
+		return 1
+	}
+	return 0
+}
+
+// runFade ramps the volume for a fade job and removes the job when done.
+// Fades in are ramped up from near silence after playback starts; fades out
+// pause and then restore the level, so the next play is not silent.
+func runFade(ctx context.Context, client *bluos.Client, job *fadeJob) error {
+	defer func() {
+		if job.current() {
+			os.Remove(fadeJobPath())
+		}
+	}()
+
+	switch job.Kind {
+	case "out":
+		if ok, err := rampVolume(ctx, client, job, job.From, 0, job.Started.Add(job.Duration)); !ok || err != nil {
+			return err
+		}
+		if _, err := client.Pause(ctx); err != nil {
+			return err
+		}
+		_, err := setLimitedVolume(ctx, client, job.From)
+		return err
+	case "in":
+		if _, err := client.SetVolume(ctx, 0); err != nil {
+			return err
+		}
+		if _, err := client.Play(ctx); err != nil {
+			return err
+		}
+		_, err := rampVolume(ctx, client, job, 0, job.To, job.Started.Add(job.Duration))
+		return err
+	case "cross":
+		if ok, err := rampVolume(ctx, client, job, job.From, 0, job.Started.Add(job.Duration/2)); !ok || err != nil {
+			return err
+		}
+		if err := client.PlayPreset(ctx, job.Preset); err != nil {
+			return err
+		}
+		_, err := rampVolume(ctx, client, job, 0, job.To, job.Started.Add(job.Duration))
+		return err
+	default:
+		return fmt.Errorf("unknown fade %q", job.Kind)
+	}
+}
+
+// rampVolume steps the volume from one level to another in even dB steps,
+// which sound even, ending at until. Each level follows from the time that
+// has passed, so slow requests make the steps coarser rather than the fade
+// longer. It reports false when the fade was cancelled or the volume was
+// changed by hand, leaving the volume as it is.
+func rampVolume(ctx context.Context, client *bluos.Client, job *fadeJob, from, to int, until time.Time) (bool, error) {
+	fromDb, toDb := max(Vol2db(from), fadeFloorDb), max(Vol2db(to), fadeFloorDb)
+	start := time.Now()
+	span := until.Sub(start)
+	last := from
+
+	for {
+		if !job.current() {
+			log.Printf("Fade %s cancelled", job.Kind)
+			return false, nil
+		}
+		if vol, err := client.Volume(ctx); err == nil && vol.Level != last {
+			log.Printf("Volume changed by hand to %d%%, stopping fade", vol.Level)
+			return false, nil
+		}
+
+		elapsed := time.Since(start)
+		done := elapsed >= span
+		level := to
+		if !done {
+			level = int(math.Round(Db2vol(fromDb + (toDb-fromDb)*float64(elapsed)/float64(span))))
+		}
+		if level != last {
+			if _, err := client.SetVolume(ctx, level); err != nil {
+				return false, err
+			}
+			last = level
+		}
+		if done {
+			return true, nil
+		}
+		time.Sleep(max(0, min(fadeStepInterval, time.Until(until))))
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/johnmccabe/go-bitbar"
+)
+
+const (
+	failureTTL      = 5 * time.Minute // How long a failed command stays visible in the menu
+	maxFailureCount = 5               // Number of failures kept in the file
+)
+
+// commandFailure records a menu command that did not succeed
+type commandFailure struct {
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+	Error   string    `json:"error"`
+}
+
+// failuresPath returns the location of the failed command log
+func failuresPath() string {
+	return tmpPath("blueos-failures.json")
+}
+
+// loadCommandFailures returns the failures recorded within failureTTL
+func loadCommandFailures() []commandFailure {
+	data, err := os.ReadFile(failuresPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to read command failures: %v", err)
+		}
+		return nil
+	}
+
+	var all, recent []commandFailure
+	if err := json.Unmarshal(data, &all); err != nil {
+		log.Printf("Ignoring unreadable command failures: %v", err)
+		return nil
+	}
+	for _, f := range all {
+		if time.Since(f.Time) < failureTTL {
+			recent = append(recent, f)
+		}
+	}
+	return recent
+}
+
+// recordCommandFailure appends a failure to the log, keeping only the latest ones
+func recordCommandFailure(command string, err error) {
+	failures := append(loadCommandFailures(), commandFailure{
+		Time:    time.Now(),
+		Command: command,
+		Error:   err.Error(),
+	})
+	if len(failures) > maxFailureCount {
+		failures = failures[len(failures)-maxFailureCount:]
+	}
+
+	data, err := json.Marshal(failures)
+	if err != nil {
+		log.Printf("Failed to encode command failures: %v", err)
+		return
+	}
+	if err := os.WriteFile(failuresPath(), data, 0o600); err != nil {
+		log.Printf("Failed to write command failures: %v", err)
+	}
+}
+
+// clearCommandFailures removes the failure log
+func clearCommandFailures() {
+	if err := os.Remove(failuresPath()); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove command failures: %v", err)
+	}
+}
+
+// addCommandFailures shows recently failed menu commands with a dismiss action
+func addCommandFailures(submenu *bitbar.SubMenu) {
+	failures := loadCommandFailures()
+	if len(failures) == 0 {
+		return
+	}
+
+	submenu.Line("---")
+	for _, f := range failures {
+		submenu.Line(fmt.Sprintf(":exclamationmark.triangle.fill: %s failed", f.Command)).Color("red").Length(MAX)
+		submenu.Line(fmt.Sprintf("%s: %s", f.Time.Format("15:04:05"), f.Error)).Alternate(true).Color("red").Length(MAX)
+	}
+	submenu.Line("Dismiss").Command(bitbar.Cmd{
+		Bash:     executablePath(),
+		Params:   []string{"cmd", "dismiss"},
+		Terminal: BoolPointer(false),
+		Refresh:  BoolPointer(true),
+	})
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"BlueOS/bluos"
+	"github.com/johnmccabe/go-bitbar"
+)
+
+// favourite is a stream kept in the local favourites file. Unlike presets it
+// is not stored on the player, so any stream URL can be added.
+type favourite struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`            // Anything /Play?url= accepts, e.g. http://... or TuneIn:s1234
+	Logo string `json:"logo,omitempty"` // Absolute image URL
+}
+
+// favouritesPath returns the location of the favourites file, which can also
+// be edited by hand
+func favouritesPath() string {
+	return configPath("favourites.json")
+}
+
+// loadFavourites reads the favourites file. A missing file yields no favourites.
+func loadFavourites() ([]favourite, error) {
+	data, err := os.ReadFile(favouritesPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var favourites []favourite
+	if err := json.Unmarshal(data, &favourites); err != nil {
+		return nil, fmt.Errorf("read %s: %w", favouritesPath(), err)
+	}
+	return favourites, nil
+}
+
+// saveFavourites writes the favourites file
+func saveFavourites(favourites []favourite) error {
+	return writeConfigFile(favouritesPath(), favourites)
+}
+
+// addFavourites adds a Favourites submenu with the streams from the
+// favourites file, and a line to add the stream that is playing
+func addFavourites(submenu *bitbar.SubMenu, client *bluos.Client, state *bluos.StateXML) {
+	favourites, err := loadFavourites()
+	if err != nil {
+		log.Printf("Favourites unavailable: %v", err)
+		submenu.Line("⚠️ Error loading favourites").Color("red")
+		return
+	}
+	streamURL := ""
+	if state != nil {
+		streamURL = state.StreamUrl
+	}
+	if len(favourites) == 0 && streamURL == "" {
+		return
+	}
+
+	log.Printf("Adding %d favourites", len(favourites))
+	submenu.Line(":heart.fill: Favourites")
+	favouritesMenu := submenu.NewSubMenu()
+	for i, f := range favourites {
+		label := f.Name
+		if f.URL == streamURL {
+			label = ":checkmark: " + label
+		}
+		line := favouritesMenu.Line(label).Length(MAX).Command(createCommand(client, "favourite", "play", strconv.Itoa(i+1)))
+		if img := artworkImage(client, f.Logo, presetArtSize); img != nil {
+			line.Image(img)
+		}
+	}
+
+	if streamURL != "" && !slices.ContainsFunc(favourites, func(f favourite) bool { return f.URL == streamURL }) {
+		if len(favourites) > 0 {
+			favouritesMenu.Line("---")
+		}
+		favouritesMenu.Line(":plus: Add current stream").Command(createCommand(client, "favourite", "add"))
+	}
+}
+
+// favouriteLogos returns the logos of the favourites, for the artwork cache
+func favouriteLogos() []string {
+	favourites, err := loadFavourites()
+	if err != nil {
+		return nil
+	}
+	logos := make([]string, 0, len(favourites))
+	for _, f := range favourites {
+		logos = append(logos, f.Logo)
+	}
+	return logos
+}
+
+// favouriteList is the output of the favourite command without arguments
+type favouriteList struct {
+	Path       string      `json:"path"`
+	Favourites []favourite `json:"favourites"`
+}
+
+func (l favouriteList) String() string {
+	if len(l.Favourites) == 0 {
+		return fmt.Sprintf("No favourites in %s", l.Path)
+	}
+	lines := make([]string, len(l.Favourites))
+	for i, f := range l.Favourites {
+		lines[i] = fmt.Sprintf("%2d  %-30s %s", i+1, f.Name, f.URL)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// cmdFavourite lists, plays, adds or removes favourites. Adding saves the
+// stream that is playing; play also accepts any stream URL.
+func cmdFavourite(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	favourites, err := loadFavourites()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) == 0 || (len(args) == 1 && args[0] == "list") {
+		if favourites == nil {
+			favourites = []favourite{}
+		}
+		return favouriteList{Path: favouritesPath(), Favourites: favourites}, nil
+	}
+
+	switch args[0] {
+	case "play":
+		if len(args) < 2 {
+			return nil, errors.New("usage: favourite play <n|name|url>")
+		}
+		if len(args) == 2 && strings.Contains(args[1], "://") {
+			if _, err := client.PlayURL(ctx, args[1]); err != nil {
+				return nil, err
+			}
+			return messageResult{fmt.Sprintf("Playing %s", args[1])}, nil
+		}
+		i, err := findFavourite(favourites, strings.Join(args[1:], " "))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := client.PlayURL(ctx, favourites[i].URL); err != nil {
+			return nil, err
+		}
+		return messageResult{fmt.Sprintf("Playing %s", favourites[i].Name)}, nil
+	case "add":
+		status, err := client.Status(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if status.StreamUrl == "" {
+			return nil, errors.New("nothing to add: the player is not playing a stream")
+		}
+		if i := slices.IndexFunc(favourites, func(f favourite) bool { return f.URL == status.StreamUrl }); i >= 0 {
+			return nil, fmt.Errorf("already a favourite: %s", favourites[i].Name)
+		}
+		f := favourite{
+			Name: cmp.Or(strings.Join(args[1:], " "), status.Name, status.Title1, status.StreamUrl),
+			URL:  status.StreamUrl,
+			Logo: absoluteImageURL(client, cmp.Or(status.Image, status.CurrentImage)),
+		}
+		if err := saveFavourites(append(favourites, f)); err != nil {
+			return nil, fmt.Errorf("save favourites: %w", err)
+		}
+		return messageResult{fmt.Sprintf("Added %s to favourites", f.Name)}, nil
+	case "remove":
+		if len(args) < 2 {
+			return nil, errors.New("usage: favourite remove <n|name>")
+		}
+		i, err := findFavourite(favourites, strings.Join(args[1:], " "))
+		if err != nil {
+			return nil, err
+		}
+		name := favourites[i].Name
+		if err := saveFavourites(slices.Delete(favourites, i, i+1)); err != nil {
+			return nil, fmt.Errorf("save favourites: %w", err)
+		}
+		return messageResult{fmt.Sprintf("Removed %s from favourites", name)}, nil
+	default:
+		return nil, errors.New("usage: favourite [list | play <n|name|url> | add [<name>] | remove <n|name>]")
+	}
+}
+
+// findFavourite returns the index of a favourite given by its number (from 1),
+// its name or a unique part of the name
+func findFavourite(favourites []favourite, query string) (int, error) {
+	return findByNumberOrName(favourites, "favourite", func(f favourite) string { return f.Name }, query)
+}
+
+// absoluteImageURL resolves an image path from /Status against the player,
+// so it still works from the favourites file
+func absoluteImageURL(client *bluos.Client, src string) string {
+	if u, err := url.Parse(src); err == nil && src != "" && !u.IsAbs() {
+		return client.BaseURL + src
+	}
+	return src
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"BlueOS/bluos"
+	"github.com/johnmccabe/go-bitbar"
+)
+
+const (
+	roomsCacheTTL         = 10 * time.Minute // How long discovered rooms are reused without a syncStat change
+	roomsDiscoveryTimeout = 3 * time.Second  // mDNS budget when looking for other rooms
+)
+
+// room is a discovered player together with its grouping
+type room struct {
+	URL  string            `json:"url"`
+	Sync *bluos.SyncStatus `json:"sync"`
+}
+
+// address returns the host:port the player is reached at
+func (r room) address() string {
+	return roomAddress(r.URL)
+}
+
+// roomAddress returns the host:port part of a player URL
+func roomAddress(playerURL string) string {
+	if u, err := url.Parse(playerURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return playerURL
+}
+
+// roomsCache stores the rooms seen from one player for one sync status
+type roomsCache struct {
+	URL       string    `json:"url"`
+	SyncStat  string    `json:"syncStat"`
+	Network   string    `json:"network"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Rooms     []room    `json:"rooms"`
+}
+
+// roomsCachePath returns the location of the rooms cache
+func roomsCachePath() string {
+	return tmpPath("blueos-rooms.json")
+}
+
+// loadRooms returns every player on the network with its /SyncStatus. The
+// list is cached until the player's syncStat changes (it does whenever its
+// group changes) or roomsCacheTTL passes, so mDNS does not run on every refresh.
+func loadRooms(ctx context.Context, client *bluos.Client, syncStat string) ([]room, error) {
+	network := currentNetworkID()
+	if data, err := os.ReadFile(roomsCachePath()); err == nil {
+		var cache roomsCache
+		if err := json.Unmarshal(data, &cache); err == nil && cache.URL == client.BaseURL &&
+			cache.SyncStat == syncStat && cache.Network == network && time.Since(cache.UpdatedAt) < roomsCacheTTL {
+			log.Printf("Using %d cached rooms", len(cache.Rooms))
+			return cache.Rooms, nil
+		}
+	}
+
+	self, err := client.SyncStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Group members are listed even when mDNS misses them
+	addrs := []string{roomAddress(client.BaseURL)}
+	if leader := self.LeaderAddress(); leader != "" {
+		addrs = append(addrs, leader)
+	}
+	addrs = append(addrs, self.MemberAddresses()...)
+	urls, err := discoverBluOSDevices(ctx, roomsDiscoveryTimeout)
+	if err != nil {
+		log.Printf("Room discovery failed: %v", err)
+	}
+	for _, u := range urls {
+		addrs = append(addrs, roomAddress(u))
+	}
+	seen := make(map[string]bool)
+	addrs = slices.DeleteFunc(addrs, func(addr string) bool {
+		dup := seen[addr]
+		seen[addr] = true
+		return dup
+	})
+
+	rooms := make([]room, len(addrs))
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		rooms[i].URL = "http://" + addr
+		if i == 0 {
+			rooms[i].Sync = self
+			continue
+		}
+		wg.Go(func() {
+			status, err := newProbeClient(rooms[i].URL).SyncStatus(ctx)
+			if err != nil {
+				log.Printf("Could not read sync status of %s: %v", rooms[i].URL, err)
+				return
+			}
+			rooms[i].Sync = status
+		})
+	}
+	wg.Wait()
+	rooms = slices.DeleteFunc(rooms, func(r room) bool { return r.Sync == nil })
+	// Keep the player's own URL as configured, e.g. with a host name
+	rooms[0].URL = client.BaseURL
+
+	data, err := json.Marshal(roomsCache{URL: client.BaseURL, SyncStat: syncStat, Network: network, UpdatedAt: time.Now(), Rooms: rooms})
+	if err == nil {
+		err = os.WriteFile(roomsCachePath(), data, 0o600)
+	}
+	if err != nil {
+		log.Printf("Failed to cache rooms: %v", err)
+	}
+	return rooms, nil
+}
+
+// findRoom returns the room at a host:port address
+func findRoom(rooms []room, address string) *room {
+	for i := range rooms {
+		if rooms[i].address() == address || rooms[i].Sync.ID == address {
+			return &rooms[i]
+		}
+	}
+	return nil
+}
+
+// roomGroup is the group a player belongs to, seen from its leader
+type roomGroup struct {
+	Leader  room   // The player itself when it is not grouped
+	Members []room // Secondaries of the leader
+	Others  []room // Rooms outside the group
+}
+
+// groupOf works out the group of the player at address from the rooms list
+func groupOf(rooms []room, address string) (*roomGroup, error) {
+	self := findRoom(rooms, address)
+	if self == nil {
+		return nil, fmt.Errorf("player %s not found among the rooms", address)
+	}
+
+	group := &roomGroup{Leader: *self}
+	if leaderAddr := self.Sync.LeaderAddress(); leaderAddr != "" {
+		leader := findRoom(rooms, leaderAddr)
+		if leader == nil {
+			return nil, fmt.Errorf("group leader %s not found", leaderAddr)
+		}
+		group.Leader = *leader
+	}
+
+	members := group.Leader.Sync.MemberAddresses()
+	for _, r := range rooms {
+		switch {
+		case r.address() == group.Leader.address():
+		case slices.Contains(members, r.address()) || slices.Contains(members, r.Sync.ID):
+			group.Members = append(group.Members, r)
+		default:
+			group.Others = append(group.Others, r)
+		}
+	}
+	return group, nil
+}
+
+// label names a group as "Living Room +2"
+func (g *roomGroup) label() string {
+	if len(g.Members) == 0 {
+		return g.Leader.Sync.Name
+	}
+	return fmt.Sprintf("%s +%d", g.Leader.Sync.Name, len(g.Members))
+}
+
+// addGroupStatusLine adds the group to the cycling status lines while grouped
+func addGroupStatusLine(app *bitbar.Plugin, client *bluos.Client, rooms []room) {
+	group, err := groupOf(rooms, roomAddress(client.BaseURL))
+	if err != nil || len(group.Members) == 0 {
+		return
+	}
+	app.StatusLine(":hifispeaker.2.fill: " + group.label()).DropDown(false).Length(MAX)
+}
+
+// addGroupMenu adds a Group submenu showing the leader and secondaries, with
+// actions to add rooms to the group or remove them
+func addGroupMenu(submenu *bitbar.SubMenu, client *bluos.Client, rooms []room) {
+	if len(rooms) == 0 {
+		return
+	}
+	group, err := groupOf(rooms, roomAddress(client.BaseURL))
+	if err != nil {
+		log.Printf("Group unavailable: %v", err)
+		return
+	}
+	if len(group.Members) == 0 && len(group.Others) == 0 {
+		return
+	}
+
+	if len(group.Members) > 0 {
+		submenu.Line(":hifispeaker.2.fill: Group: " + group.label()).Length(MAX)
+	} else {
+		submenu.Line(":hifispeaker: Group")
+	}
+	groupMenu := submenu.NewSubMenu()
+
+	groupMenu.Line(fmt.Sprintf(":star.fill: %s (leader)", group.Leader.Sync.Name)).Length(MAX)
+	if len(group.Members) > 0 {
+		groupMenu.Line("Click to remove").Color("gray")
+		for _, r := range group.Members {
+			groupMenu.Line(":minus.circle: " + r.Sync.Name).Length(MAX).Command(createCommand(client, "group", "remove", r.URL))
+		}
+	}
+
+	if len(group.Others) > 0 {
+		groupMenu.Line("---")
+		groupMenu.Line("Add room").Color("gray")
+		for _, r := range group.Others {
+			groupMenu.Line(":plus.circle: " + r.Sync.Name).Length(MAX).Command(createCommand(client, "group", "add", r.URL))
+		}
+	}
+
+	if len(group.Members) > 0 {
+		groupMenu.Line("---")
+		groupMenu.Line(":rectangle.split.3x1: Ungroup all").Command(createCommand(client, "group", "ungroup"))
+	}
+}
+
+// roomInfo describes a room in command output
+type roomInfo struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// groupResult is the output of the group command
+type groupResult struct {
+	Leader  roomInfo   `json:"leader"`
+	Members []roomInfo `json:"members"`
+	Others  []roomInfo `json:"others"`
+}
+
+func (r groupResult) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Leader:  %s (%s)\n", r.Leader.Name, r.Leader.URL)
+	for _, m := range r.Members {
+		fmt.Fprintf(&b, "Member:  %s (%s)\n", m.Name, m.URL)
+	}
+	for _, o := range r.Others {
+		fmt.Fprintf(&b, "Other:   %s (%s)\n", o.Name, o.URL)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// newRoomInfos converts rooms for command output
+func newRoomInfos(rooms []room) []roomInfo {
+	infos := make([]roomInfo, len(rooms))
+	for i, r := range rooms {
+		infos[i] = roomInfo{Name: r.Sync.Name, URL: r.URL}
+	}
+	return infos
+}
+
+// cmdGroup shows or changes the group of the player. Changes are sent to the
+// group leader, so they work from any member.
+func cmdGroup(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	action := "list"
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+
+	status, err := client.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rooms, err := loadRooms(ctx, client, status.SyncStat)
+	if err != nil {
+		return nil, err
+	}
+	group, err := groupOf(rooms, roomAddress(client.BaseURL))
+	if err != nil {
+		return nil, err
+	}
+	leader := bluos.NewClient(group.Leader.URL)
+
+	switch {
+	case action == "list" && len(args) == 0:
+		return groupResult{
+			Leader:  roomInfo{Name: group.Leader.Sync.Name, URL: group.Leader.URL},
+			Members: newRoomInfos(group.Members),
+			Others:  newRoomInfos(group.Others),
+		}, nil
+	case action == "add" && len(args) > 0:
+		r, err := findRoomByName(group.Others, strings.Join(args, " "))
+		if err != nil {
+			return nil, err
+		}
+		return messageCommand(fmt.Sprintf("Added %s to %s", r.Sync.Name, group.Leader.Sync.Name), leader.AddSlave(ctx, r.address()))
+	case action == "remove" && len(args) > 0:
+		r, err := findRoomByName(group.Members, strings.Join(args, " "))
+		if err != nil {
+			return nil, err
+		}
+		return messageCommand(fmt.Sprintf("Removed %s from %s", r.Sync.Name, group.Leader.Sync.Name), leader.RemoveSlave(ctx, r.address()))
+	case action == "ungroup" && len(args) == 0:
+		for _, r := range group.Members {
+			if err := leader.RemoveSlave(ctx, r.address()); err != nil {
+				return nil, fmt.Errorf("remove %s: %w", r.Sync.Name, err)
+			}
+		}
+		return messageResult{fmt.Sprintf("Ungrouped %s", group.Leader.Sync.Name)}, nil
+	default:
+		return nil, errors.New("usage: group [list | add <room> | remove <room> | ungroup]")
+	}
+}
+
+// findRoomByName resolves a room by URL, address, exact name or unique name
+// fragment (case-insensitive)
+func findRoomByName(rooms []room, query string) (*room, error) {
+	query = strings.TrimSpace(query)
+	for i := range rooms {
+		if r := &rooms[i]; query != "" && (r.URL == query || r.address() == query) {
+			return r, nil
+		}
+	}
+	i, err := findByName(rooms, "room", func(r room) string { return r.Sync.Name }, query)
+	if err != nil {
+		return nil, err
+	}
+	return &rooms[i], nil
+}
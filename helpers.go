@@ -2,124 +2,112 @@ package main
 
 import (
 	"context"
-
 	"fmt"
-	"io"
 	"log"
 	"math"
-	"net/http"
-	"net/url"
-
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
+	"BlueOS/bluos"
 	"github.com/hashicorp/mdns"
-	"github.com/johnmccabe/go-bitbar"
 )
 
-// createVolumeCommand creates a bitbar command for volume control operations
-func createVolumeCommand(playerUrl string, params map[string]string) bitbar.Cmd {
-	baseURL := fmt.Sprintf("%s/Volume", playerUrl)
-	reqURL, err := url.Parse(baseURL)
-	if err != nil {
-		// For a command creation function, log the error but continue with a default
-		log.Printf("Error parsing URL %s: %v", baseURL, err)
-		return createCommand(baseURL) // Fallback to basic command
-	}
-
-	query := reqURL.Query()
-	for key, value := range params {
-		query.Set(key, value)
-	}
-	reqURL.RawQuery = query.Encode()
-
-	return bitbar.Cmd{
-		Bash:     "curl",
-		Params:   []string{"-sf", reqURL.String()},
-		Terminal: BoolPointer(false),
-		Refresh:  BoolPointer(true),
-	}
-}
-
 // Db2vol converts dB to volume percentage (0-100)
 // This is the inverse of the vol2db function and maintains compatibility
 func Db2vol(db float64) float64 {
 	return 100.0 * math.Pow(10.0, db/60.0)
 }
 
-// tweaked from: https://stackoverflow.com/a/42718113/1170664
-func getXML(url string) ([]byte, error) {
-	log.Printf("Fetching XML from: %s", url)
+// Vol2db converts a volume percentage (0-100) to dB, the inverse of Db2vol
+func Vol2db(level int) float64 {
+	if level <= 0 {
+		return math.Inf(-1)
+	}
+	return 60.0 * math.Log10(float64(level)/100.0)
+}
 
-	// Set timeout for requests - increased from 5s to 10s for better reliability
-	client := &http.Client{
-		Timeout: 10 * time.Second,
+// tmpPath returns the path of a plugin file inside TMPDIR
+func tmpPath(name string) string {
+	dir := TMP
+	if dir == "" {
+		dir = os.TempDir()
 	}
+	return filepath.Join(dir, name)
+}
 
-	// Implement retry logic (3 attempts)
-	maxRetries := 3
-	var lastErr error
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		log.Printf("Attempt %d/%d to fetch from %s", attempt, maxRetries, url)
+func BoolPointer(b bool) *bool {
+	return &b
+}
 
-		resp, err := client.Get(url)
-		if err != nil {
-			log.Printf("Error connecting to %s (attempt %d/%d): %v", url, attempt, maxRetries, err)
-			lastErr = fmt.Errorf("GET error: %v", err)
-			if attempt < maxRetries {
-				time.Sleep(500 * time.Millisecond) // Short delay between retries
-				continue
-			}
-			break
-		}
-		defer resp.Body.Close()
+// findByName returns the index of the item that query names: its exact name,
+// a unique part of the name or, failing that, several words found anywhere in
+// the name, e.g. "soma groove" for "SomaFM Groove Salad". Case is ignored and
+// kind names the items in errors.
+func findByName[T any](items []T, kind string, name func(T) string, query string) (int, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return 0, fmt.Errorf("no %s given", kind)
+	}
 
-		if resp.StatusCode != http.StatusOK {
-			log.Printf("Bad status code from %s (attempt %d/%d): %d", url, attempt, maxRetries, resp.StatusCode)
-			lastErr = fmt.Errorf("Status error: %v", resp.StatusCode)
-			if attempt < maxRetries {
-				time.Sleep(500 * time.Millisecond) // Short delay between retries
-				continue
-			}
-			break
+	var matches, wordMatches []int
+	for i, item := range items {
+		switch n := name(item); {
+		case strings.EqualFold(n, query):
+			return i, nil
+		case strings.Contains(strings.ToLower(n), strings.ToLower(query)):
+			matches = append(matches, i)
+		case matchesWords(n, query):
+			wordMatches = append(wordMatches, i)
 		}
+	}
+	if len(matches) == 0 {
+		matches = wordMatches
+	}
 
-		data, err := io.ReadAll(resp.Body)
-		if err != nil {
-			log.Printf("Error reading response body from %s (attempt %d/%d): %v", url, attempt, maxRetries, err)
-			lastErr = fmt.Errorf("Read body: %v", err)
-			if attempt < maxRetries {
-				time.Sleep(500 * time.Millisecond) // Short delay between retries
-				continue
-			}
-			break
+	switch len(matches) {
+	case 0:
+		return 0, fmt.Errorf("no %s matches %q", kind, query)
+	case 1:
+		return matches[0], nil
+	default:
+		names := make([]string, len(matches))
+		for i, m := range matches {
+			names[i] = name(items[m])
 		}
-
-		// If we get here, we succeeded
-		log.Printf("Successfully retrieved %d bytes from %s on attempt %d/%d", len(data), url, attempt, maxRetries)
-		return data, nil
+		return 0, fmt.Errorf("%q matches several %ss: %s", query, kind, strings.Join(names, ", "))
 	}
-
-	// If we get here, all attempts failed
-	return []byte{}, lastErr
 }
 
-func BoolPointer(b bool) *bool {
-	return &b
+// findByNumberOrName is findByName for numbered lists, where a number (from 1)
+// picks an item by its position
+func findByNumberOrName[T any](items []T, kind string, name func(T) string, query string) (int, error) {
+	if n, err := strconv.Atoi(strings.TrimSpace(query)); err == nil {
+		if n < 1 || n > len(items) {
+			return 0, fmt.Errorf("no %s number %d", kind, n)
+		}
+		return n - 1, nil
+	}
+	return findByName(items, kind, name, query)
 }
 
-// createCommand is a helper to create curl commands for BluOS API endpoints
-func createCommand(url string) bitbar.Cmd {
-	return bitbar.Cmd{
-		Bash:     "curl",
-		Params:   []string{"-sf", url},
-		Terminal: BoolPointer(false),
-		Refresh:  BoolPointer(true),
+// matchesWords reports whether every word of query appears in name, ignoring case
+func matchesWords(name, query string) bool {
+	words := strings.Fields(strings.ToLower(query))
+	name = strings.ToLower(name)
+	for _, w := range words {
+		if !strings.Contains(name, w) {
+			return false
+		}
 	}
+	return len(words) > 0
 }
 
 // discoverBluOSDevices discovers BluOS players on the local network using mDNS/Bonjour
 // Returns a slice of device URLs (http://ip:port) found on the network
-func discoverBluOSDevices(timeout time.Duration) ([]string, error) {
+func discoverBluOSDevices(ctx context.Context, timeout time.Duration) ([]string, error) {
 	log.Printf("Starting BluOS device discovery (timeout: %v)", timeout)
 
 	// Channel to collect discovered services
@@ -155,7 +143,7 @@ func discoverBluOSDevices(timeout time.Duration) ([]string, error) {
 	}()
 
 	// Collect discovered devices with overall timeout
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	for {
@@ -187,10 +175,11 @@ func discoverBluOSDevices(timeout time.Duration) ([]string, error) {
 	}
 }
 
-// findValidBluOSDevice discovers BluOS devices and returns the first working one
-// It tests each discovered device with a simple /Status call to verify it's accessible
-func findValidBluOSDevice(timeout time.Duration) (string, error) {
-	devices, err := discoverBluOSDevices(timeout)
+// findValidBluOSDevice discovers BluOS devices and returns a working one.
+// When name is set the device with that name (case-insensitive) is preferred;
+// with strict set no other device is accepted.
+func findValidBluOSDevice(ctx context.Context, timeout time.Duration, name string, strict bool) (string, error) {
+	devices, err := discoverBluOSDevices(ctx, timeout)
 	if err != nil {
 		return "", fmt.Errorf("device discovery failed: %w", err)
 	}
@@ -200,45 +189,103 @@ func findValidBluOSDevice(timeout time.Duration) (string, error) {
 	}
 
 	// Test each device to find a working one
-	client := &http.Client{Timeout: 3 * time.Second}
-
+	firstWorking := ""
 	for _, deviceURL := range devices {
-		statusURL := fmt.Sprintf("%s/Status", deviceURL)
-		log.Printf("Testing BluOS device: %s", statusURL)
+		log.Printf("Testing BluOS device: %s", deviceURL)
 
-		resp, err := client.Get(statusURL)
+		if name == "" {
+			if err := verifyDevice(ctx, deviceURL); err != nil {
+				log.Printf("Device %s not usable: %v", deviceURL, err)
+				continue
+			}
+			log.Printf("Found working BluOS device: %s", deviceURL)
+			return deviceURL, nil
+		}
+
+		// /SyncStatus both verifies the device and tells its name
+		sync, err := newProbeClient(deviceURL).SyncStatus(ctx)
 		if err != nil {
-			log.Printf("Device %s unreachable: %v", deviceURL, err)
+			log.Printf("Device %s not usable: %v", deviceURL, err)
 			continue
 		}
-		if err := resp.Body.Close(); err != nil {
-			log.Printf("Failed to close response body for %s: %v", deviceURL, err)
-		}
-
-		if resp.StatusCode == http.StatusOK {
-			log.Printf("Found working BluOS device: %s", deviceURL)
+		if strings.EqualFold(sync.Name, name) {
+			log.Printf("Found BluOS device %q: %s", sync.Name, deviceURL)
 			return deviceURL, nil
 		}
-
-		log.Printf("Device %s returned status %d", deviceURL, resp.StatusCode)
+		log.Printf("Skipping %s (%q), looking for %q", deviceURL, sync.Name, name)
+		if firstWorking == "" {
+			firstWorking = deviceURL
+		}
 	}
 
+	if firstWorking != "" && !strict {
+		log.Printf("BluOS device %q not found, using %s", name, firstWorking)
+		return firstWorking, nil
+	}
+	if name != "" {
+		return "", fmt.Errorf("no working BluOS device named %q (tested %d device(s))", name, len(devices))
+	}
 	return "", fmt.Errorf("no working BluOS devices found (tested %d device(s))", len(devices))
 }
 
-// getBluOSPlayerURL returns the BluOS player URL using discovery first, then fallback to env var
-func getBluOSPlayerURL(fallbackURL string) (string, error) {
-	// Try automatic discovery first (5 second timeout)
-	if discoveredURL, err := findValidBluOSDevice(5 * time.Second); err == nil {
+// newProbeClient returns a client with a short timeout and no retries for quick checks
+func newProbeClient(deviceURL string) *bluos.Client {
+	client := bluos.NewClient(deviceURL)
+	client.Timeout = 3 * time.Second
+	client.Retries = 1
+	return client
+}
+
+// verifyDevice checks that a device answers a simple /Status call
+func verifyDevice(ctx context.Context, deviceURL string) error {
+	_, err := newProbeClient(deviceURL).Get(ctx, "/Status", nil)
+	return err
+}
+
+// preferredPlayerName returns the room to look for: BLUE_PLAYER_NAME pins one,
+// otherwise the room picked in the Players submenu is preferred
+func preferredPlayerName() (name string, pinned bool) {
+	if name := myConfig["BLUE_PLAYER_NAME"]; name != "" {
+		return name, true
+	}
+	return loadState().PlayerName, false
+}
+
+// getBluOSPlayerURL returns the BluOS player URL using the discovery cache first,
+// then discovery, then the player picked in the menu, then fallback to env var
+func getBluOSPlayerURL(ctx context.Context, fallbackURL string) (string, error) {
+	network := currentNetworkID()
+	name, pinned := preferredPlayerName()
+
+	// Skip mDNS when the cached device still answers on this network
+	if cachedURL, ok := cachedBluOSDevice(ctx, network, name); ok {
+		return cachedURL, nil
+	}
+
+	// Try automatic discovery next (5 second timeout)
+	if discoveredURL, err := findValidBluOSDevice(ctx, 5*time.Second, name, pinned); err == nil {
 		log.Printf("Using discovered BluOS device: %s", discoveredURL)
+		rememberDevice(ctx, discoveredURL, network)
 		return discoveredURL, nil
 	} else {
 		log.Printf("Auto-discovery failed: %v", err)
 	}
 
+	// The player picked in the menu may still answer when mDNS is blocked
+	if state := loadState(); !pinned && state.PlayerURL != "" {
+		if err := verifyDevice(ctx, state.PlayerURL); err == nil {
+			log.Printf("Using chosen BluOS device: %s", state.PlayerURL)
+			rememberDevice(ctx, state.PlayerURL, network)
+			return state.PlayerURL, nil
+		}
+	}
+
 	// Fall back to manually configured URL
 	if fallbackURL != "" {
 		log.Printf("Using configured BluOS device: %s", fallbackURL)
+		if err := verifyDevice(ctx, fallbackURL); err == nil {
+			rememberDevice(ctx, fallbackURL, network)
+		}
 		return fallbackURL, nil
 	}
 
@@ -247,25 +294,22 @@ func getBluOSPlayerURL(fallbackURL string) (string, error) {
 
 // isDeviceReachable performs a simple network check to see if the device is reachable,
 // even if the main API might be having issues
-func isDeviceReachable(url string) bool {
+func isDeviceReachable(ctx context.Context, client *bluos.Client) bool {
+	// Use a single attempt with long timeout for reachability testing
+	probe := *client
+	probe.Timeout = 15 * time.Second
+	probe.Retries = 1
+
 	// Try a few different endpoints to increase chances of success
 	endpoints := []string{"/Status", "/Volume", "/"}
 
 	for _, endpoint := range endpoints {
-		fullURL := fmt.Sprintf("%s%s", url, endpoint)
-		log.Printf("Checking device reachability via: %s", fullURL)
-
-		// Use a simple check with long timeout for reachability testing
-		client := &http.Client{
-			Timeout: 15 * time.Second, // Longer timeout for reachability check
-		}
+		log.Printf("Checking device reachability via: %s", probe.URL(endpoint, nil))
 
-		resp, err := client.Get(fullURL)
-		if err == nil {
-			log.Printf("Device is reachable via %s (status: %d)", endpoint, resp.StatusCode)
-			if closeErr := resp.Body.Close(); closeErr != nil {
-				log.Printf("Failed to close response body for %s: %v", fullURL, closeErr)
-			}
+		// Any HTTP answer, even an error status, means the device is on the network
+		_, err := probe.Get(ctx, endpoint, nil)
+		if err == nil || !bluos.IsUnreachable(err) {
+			log.Printf("Device is reachable via %s", endpoint)
 			return true
 		}
 
@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestFindByNumberOrName(t *testing.T) {
+	names := []string{"Morning Jazz", "SomaFM Groove Salad", "Jazz24", "Radio Swiss Jazz"}
+	tests := []struct {
+		name    string
+		query   string
+		want    int
+		wantErr bool
+	}{
+		{"number", "2", 1, false},
+		{"number out of range", "5", 0, true},
+		{"zero", "0", 0, true},
+		{"exact name", "jazz24", 2, false},
+		{"exact name among fragments", " Jazz24 ", 2, false},
+		{"unique fragment", "swiss", 3, false},
+		{"ambiguous fragment", "jazz", 0, true},
+		{"words", "soma salad", 1, false},
+		{"fragment before words", "radio", 3, false},
+		{"no match", "techno", 0, true},
+		{"empty", "", 0, true},
+		{"blank", "  ", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findByNumberOrName(names, "station", func(s string) string { return s }, tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("findByNumberOrName(%q) error = %v, want error %v", tt.query, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("findByNumberOrName(%q) = %d, want %d", tt.query, got, tt.want)
+			}
+		})
+	}
+}
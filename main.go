@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/johnmccabe/go-bitbar"
 	"github.com/joho/godotenv"
@@ -13,18 +18,32 @@ import (
 
 var (
 	MAX      = 40
+	DEADLINE = 8 * time.Second // Time budget for fetching from the player in one run
 	myConfig map[string]string
 	TMP      = os.Getenv("TMPDIR")
 )
 
 func init() {
+	// Keep script output clean; set BLUEOS_DEBUG=1 to see the logs
+	cli := len(os.Args) > 1 && isCLICommand(os.Args[1])
+	command := len(os.Args) > 1 && os.Args[1] == "cmd"
+	if cli && os.Getenv("BLUEOS_DEBUG") == "" {
+		log.SetOutput(io.Discard)
+	}
+
 	var err error
 	envPath := fmt.Sprintf("%s/.env", os.Getenv("SWIFTBAR_PLUGINS_PATH"))
 	log.Printf("Loading env file from: %s", envPath)
 
 	myConfig, err = godotenv.Read(envPath)
 	if err != nil {
-		log.Fatalln("Error loading .env file:", err)
+		if !cli && !command {
+			log.Fatalln("Error loading .env file:", err)
+		}
+		// Scripts and menu commands, including background workers started
+		// from the CLI, can rely on discovery or --url without a .env file
+		log.Printf("No .env file, using defaults: %v", err)
+		myConfig = map[string]string{}
 	}
 
 	// Log all config values for debugging
@@ -38,70 +57,34 @@ func main() {
 	if m, e := strconv.Atoi(myConfig["MAX"]); e == nil {
 		MAX = m
 	}
-
-	// Get BluOS device URL (try discovery first, fall back to config)
-	bluePlayerUrl, err := getBluOSPlayerURL(myConfig["BLUE_URL"])
-	if err != nil {
-		log.Printf("Failed to determine BluOS player URL: %v", err)
-
-		// Create error menu
-		app := bitbar.New()
-		submenu := app.NewSubMenu()
-		app.StatusLine(":exclamationmark.triangle.fill: BluOS Not Found").DropDown(false).Color("red")
-		submenu.Line(":exclamationmark.triangle.fill: No BluOS Device Found").Color("red")
-		submenu.Line("Auto-discovery failed and no BLUE_URL configured").Color("gray")
-		submenu.Line("---")
-		submenu.Line("Troubleshooting:").Color("gray")
-		submenu.Line("• Ensure BluOS device is powered on").Color("gray")
-		submenu.Line("• Check you're on the same Wi-Fi network").Color("gray")
-		submenu.Line("• Set BLUE_URL in .env if discovery fails").Color("gray")
-		submenu.Line(fmt.Sprintf("Network: %s", myConfig["BLUE_WIFI"])).Color("gray")
-		app.Render()
-		return
+	if d, e := strconv.Atoi(myConfig["BLUE_DEADLINE"]); e == nil && d > 0 {
+		DEADLINE = time.Duration(d) * time.Second
 	}
-	log.Printf("Using BluOS URL: %s", bluePlayerUrl)
 
-	// Create BitBar app
-	app := bitbar.New()
-
-	// Try to contact the player
-	statusUrl := fmt.Sprintf("%s/Status", bluePlayerUrl)
-	stateXML, err := getXML(statusUrl)
-	if err != nil {
-		log.Printf("Failed to get BluOS status XML: %v", err)
-
-		// Check if the device is reachable at all
-		if isDeviceReachable(bluePlayerUrl) {
-			// Device is reachable but API might be having issues
-			submenu := app.NewSubMenu()
-			app.StatusLine(":exclamationmark.circle.fill: BluOS Issues").DropDown(false).Color("orange")
-			submenu.Line(":exclamationmark.circle.fill: Player API Issues").Color("orange")
-			submenu.Line("Device is reachable but API is not responding properly").Color("gray")
-			submenu.Line("The player might be updating or rebooting").Color("gray")
-			submenu.Line("Try again in a few minutes").Color("gray")
-			submenu.Line(fmt.Sprintf("URL: %s", bluePlayerUrl)).Color("gray")
-			submenu.Line("---")
-			submenu.Line("Attempt Manual Refresh").Command(createCommand(statusUrl))
-		} else {
-			// Device appears to be completely offline
-			submenu := app.NewSubMenu()
-			app.StatusLine(":exclamationmark.triangle.fill: BluOS Disconnected").DropDown(false).Color("red")
-			submenu.Line(":exclamationmark.triangle.fill: Player Disconnected").Color("red")
-			submenu.Line("Check if your BluOS player is turned on").Color("gray")
-			submenu.Line("Make sure you're on the same network").Color("gray")
-			submenu.Line(fmt.Sprintf("Network: %s", myConfig["BLUE_WIFI"])).Color("gray")
-			submenu.Line(fmt.Sprintf("URL: %s", bluePlayerUrl)).Color("gray")
-			submenu.Line("---")
-			submenu.Line("Attempt Manual Refresh").Command(createCommand(statusUrl))
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "daemon":
+			// Long-running daemon mode: blueos.10s.gobin daemon
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			if err := runDaemon(ctx); err != nil {
+				log.Fatalln("Daemon failed:", err)
+			}
+			return
+		case "cmd":
+			// Command mode used by menu items: blueos.10s.gobin cmd volume --db -1
+			os.Exit(runCommand(os.Args[2:]))
+		default:
+			// Scriptable CLI: blueos.10s.gobin status --json
+			if isCLICommand(os.Args[1]) {
+				os.Exit(runCLI(os.Args[1:]))
+			}
 		}
-	} else {
-		// We're connected successfully
-		log.Printf("Successfully connected to BluOS player (%d bytes received)", len(stateXML))
-
-		// Use the modular menu builder from menu.go
-		buildPlayerMenu(&app, bluePlayerUrl)
 	}
 
-	// Render the menu
+	// Create BitBar app and render the current snapshot; loadSnapshot bounds
+	// discovery and the fetch with their own deadlines
+	app := bitbar.New()
+	renderMenu(&app, loadSnapshot(context.Background()))
 	app.Render()
 }
@@ -1,61 +1,174 @@
 package main
 
 import (
-	"encoding/xml"
 	"fmt"
 	"log"
+	"slices"
 	"strconv"
+	"time"
 
+	"BlueOS/bluos"
 	"github.com/johnmccabe/go-bitbar"
 )
 
+// renderMenu renders a snapshot, falling back to error menus when the player is missing
+func renderMenu(app *bitbar.Plugin, snap *Snapshot) {
+	if snap.URL == "" {
+		renderNotFoundMenu(app)
+		return
+	}
+
+	client := bluos.NewClient(snap.URL)
+	if snap.StatusErr != nil && !snap.StatusErr.Parse && !snap.StatusErr.Timeout {
+		renderUnavailableMenu(app, client, snap.Reachable)
+		return
+	}
+
+	// We're connected successfully
+	buildPlayerMenu(app, client, snap)
+}
+
+// renderNotFoundMenu renders the menu shown when no player could be located
+func renderNotFoundMenu(app *bitbar.Plugin) {
+	submenu := app.NewSubMenu()
+	app.StatusLine(":exclamationmark.triangle.fill: BluOS Not Found").DropDown(false).Color("red")
+	submenu.Line(":exclamationmark.triangle.fill: No BluOS Device Found").Color("red")
+	submenu.Line("Auto-discovery failed and no BLUE_URL configured").Color("gray")
+	submenu.Line("---")
+	submenu.Line("Troubleshooting:").Color("gray")
+	submenu.Line("• Ensure BluOS device is powered on").Color("gray")
+	submenu.Line("• Check you're on the same Wi-Fi network").Color("gray")
+	submenu.Line("• Set BLUE_URL in .env if discovery fails").Color("gray")
+	submenu.Line(fmt.Sprintf("Network: %s", myConfig["BLUE_WIFI"])).Color("gray")
+}
+
+// renderUnavailableMenu renders the menu shown when /Status could not be fetched
+func renderUnavailableMenu(app *bitbar.Plugin, client *bluos.Client, reachable bool) {
+	submenu := app.NewSubMenu()
+
+	if reachable {
+		// Device is reachable but API might be having issues
+		app.StatusLine(":exclamationmark.circle.fill: BluOS Issues").DropDown(false).Color("orange")
+		submenu.Line(":exclamationmark.circle.fill: Player API Issues").Color("orange")
+		submenu.Line("Device is reachable but API is not responding properly").Color("gray")
+		submenu.Line("The player might be updating or rebooting").Color("gray")
+		submenu.Line("Try again in a few minutes").Color("gray")
+	} else {
+		// Device appears to be completely offline
+		app.StatusLine(":exclamationmark.triangle.fill: BluOS Disconnected").DropDown(false).Color("red")
+		submenu.Line(":exclamationmark.triangle.fill: Player Disconnected").Color("red")
+		submenu.Line("Check if your BluOS player is turned on").Color("gray")
+		submenu.Line("Make sure you're on the same network").Color("gray")
+		submenu.Line(fmt.Sprintf("Network: %s", myConfig["BLUE_WIFI"])).Color("gray")
+	}
+	submenu.Line(fmt.Sprintf("URL: %s", client.BaseURL)).Color("gray")
+	addCommandFailures(submenu)
+	submenu.Line("---")
+	submenu.Line("Attempt Manual Refresh").Refresh()
+}
+
 // buildPlayerMenu builds the main menu structure based on player state and volume info
-func buildPlayerMenu(app *bitbar.Plugin, bluePlayerUrl string) {
-	log.Printf("Building player menu for %s", bluePlayerUrl)
-	statusUrl := fmt.Sprintf("%s/Status", bluePlayerUrl)
-	presetsUrl := fmt.Sprintf("%s/Presets", bluePlayerUrl)
+func buildPlayerMenu(app *bitbar.Plugin, client *bluos.Client, snap *Snapshot) {
+	log.Printf("Building player menu for %s", client.BaseURL)
 
 	submenu := app.NewSubMenu()
 
-	// Process status data and create status bar
-	createStatusDisplay(app, submenu, statusUrl, bluePlayerUrl)
+	// Process status data and create status bar, with the album art or station
+	// logo on the now-playing line
+	if nowPlaying := createStatusDisplay(app, submenu, client, snap.Status, snap.StatusErr); nowPlaying != nil {
+		if img := artworkImage(client, nowPlayingArtwork(snap.Status), nowPlayingArtSize); img != nil {
+			nowPlaying.Image(img)
+		}
+	}
+	addGroupStatusLine(app, client, snap.Rooms)
+
+	// Add elapsed and remaining time of the current track
+	if snap.Status != nil {
+		addProgressStatusLine(app, snap.Status, snap.StatusAt)
+		addTrackProgress(submenu, snap.Status, snap.StatusAt)
+	}
+
+	// Add service actions and next/previous, shuffle, repeat and seek for queue playback
+	if snap.Status != nil {
+		addStatusActions(submenu, client, snap.Status)
+		addTransportControls(submenu, client, snap.Status)
+		addFadeControls(submenu, client, snap.Status)
+		addQueueMenu(submenu, client, snap.Status, snap.Queue)
+		addSleepMenu(submenu, client, snap.Status)
+	}
+	addAlarmsMenu(submenu, client)
+	if snap.QueueErr != nil {
+		log.Printf("Queue unavailable: %s", snap.QueueErr.Message)
+	}
+
+	// Add the multi-room group with rooms to add or remove
+	addGroupMenu(submenu, client, snap.Rooms)
+	if snap.Status != nil {
+		addMoveMenu(submenu, client, snap.Status, snap.Rooms)
+	}
+	if snap.RoomsErr != nil {
+		log.Printf("Rooms unavailable: %s", snap.RoomsErr.Message)
+	}
+
+	// Show menu commands that failed since the last refreshes
+	addCommandFailures(submenu)
 
 	// Add separator
 	submenu.Line("---")
 
 	// Add radio presets directly (no header)
-	addRadioPresets(submenu, presetsUrl, bluePlayerUrl)
+	addRadioPresets(submenu, client, snap.Status, snap.Presets, snap.PresetsErr)
+	addFavourites(submenu, client, snap.Status)
+	addScenesMenu(submenu, client)
+
+	// Add the services, inputs and library to browse and search
+	addBrowseMenu(submenu, client, snap.Browse)
+	addSearchMenu(submenu, client)
+	if snap.BrowseErr != nil {
+		log.Printf("Browse unavailable: %s", snap.BrowseErr.Message)
+	}
 
 	// Add separator
 	submenu.Line("---")
 
 	// Add volume info (no header)
-	volStatus := addVolumeInfo(submenu, bluePlayerUrl)
+	volStatus := addVolumeInfo(submenu, client, snap.Volume, snap.VolumeErr)
 
-	// Add volume presets (no header)
-	addVolumePresets(submenu, bluePlayerUrl, volStatus)
+	// Add the volume cap in force and the volume presets below it (no header)
+	limit := currentVolumeLimit(time.Now())
+	addVolumeLimitInfo(submenu, limit)
+	addVolumePresets(submenu, client, volStatus, limit)
 
 	// Add mute toggle
-	addMuteToggle(submenu, bluePlayerUrl, volStatus)
+	addMuteToggle(submenu, client, volStatus)
+	addAutoVolumeUndo(submenu, client, snap.Status)
+
+	// Add the player picker when there are several rooms
+	if len(snap.Rooms) > 1 {
+		submenu.Line("---")
+		addPlayersMenu(submenu, client, snap.Rooms)
+	}
 
 	log.Printf("Menu building completed")
 }
 
-// createStatusDisplay fetches the player status and delegates the display logic.
-func createStatusDisplay(app *bitbar.Plugin, submenu *bitbar.SubMenu, statusUrl, bluePlayerUrl string) {
+// createStatusDisplay delegates the display logic based on the player status.
+// It returns the now-playing line of the dropdown, if there is one.
+func createStatusDisplay(app *bitbar.Plugin, submenu *bitbar.SubMenu, client *bluos.Client, state *bluos.StateXML, statusErr *SectionError) *bitbar.Line {
 	log.Printf("Creating status display")
-	xmlBytes, err := getXML(statusUrl)
-	if err != nil {
-		submenu.Line(err.Error()).Color("red").Length(MAX)
-		log.Printf("Failed to get XML: %v", err)
-		return
-	}
-
-	var state StateXML
-	if err := xml.Unmarshal(xmlBytes, &state); err != nil {
-		log.Printf("Failed to parse status XML: %v", err)
+	if statusErr != nil && statusErr.Timeout {
+		log.Printf("Status missed the deadline: %s", statusErr.Message)
+		app.StatusLine(":hourglass: BluOS").DropDown(false).Color("orange")
+		submenu.Line(":hourglass: Player status is slow to respond").Color("gray")
+		return nil
+	} else if statusErr != nil && statusErr.Parse {
+		log.Printf("Failed to parse status XML: %s", statusErr.Message)
 		submenu.Line("XML parsing error - Limited display").Color("orange")
-		return
+		return nil
+	} else if statusErr != nil {
+		submenu.Line(statusErr.Message).Color("red").Length(MAX)
+		log.Printf("Failed to get XML: %s", statusErr.Message)
+		return nil
 	}
 
 	log.Printf("Player state: %s, Service: %s", state.State, state.Service)
@@ -64,16 +177,17 @@ func createStatusDisplay(app *bitbar.Plugin, submenu *bitbar.SubMenu, statusUrl,
 	switch state.State {
 	case "connecting":
 		handleConnectingState(app)
+		return nil
 	case "play":
-		handlePlayState(app, submenu, &state, bluePlayerUrl)
+		return handlePlayState(app, submenu, state, client)
 	case "stream":
-		handleStreamState(app, submenu, &state, bluePlayerUrl)
+		return handleStreamState(app, submenu, state, client)
 	case "pause":
-		handlePauseState(app, submenu, &state, bluePlayerUrl)
+		return handlePauseState(app, submenu, state, client)
 	case "stop":
-		handleStopState(app, submenu, &state, bluePlayerUrl)
+		return handleStopState(app, submenu, state, client)
 	default:
-		handleDefaultState(app, submenu, &state)
+		return handleDefaultState(app, submenu, state)
 	}
 }
 
@@ -85,7 +199,7 @@ func handleConnectingState(app *bitbar.Plugin) {
 }
 
 // handlePlayState handles the display for the 'play' state.
-func handlePlayState(app *bitbar.Plugin, submenu *bitbar.SubMenu, state *StateXML, bluePlayerUrl string) {
+func handlePlayState(app *bitbar.Plugin, submenu *bitbar.SubMenu, state *bluos.StateXML, client *bluos.Client) *bitbar.Line {
 	icon := ":play.circle.fill:"
 	if state.Shuffle == "1" {
 		icon = ":shuffle.circle.fill:"
@@ -101,13 +215,14 @@ func handlePlayState(app *bitbar.Plugin, submenu *bitbar.SubMenu, state *StateXM
 	app.StatusLine(l2).DropDown(false).Length(MAX)
 	app.StatusLine(l3).DropDown(false).Length(MAX)
 
-	cmd := createCommand(fmt.Sprintf("%s/Pause?toggle=1", bluePlayerUrl))
-	submenu.Line(s1).Command(cmd)
+	cmd := createCommand(client, "toggle")
+	line := submenu.Line(s1).Command(cmd)
 	submenu.Line(s2).Alternate(true)
+	return line
 }
 
 // handleStreamState handles the display for the 'stream' state.
-func handleStreamState(app *bitbar.Plugin, submenu *bitbar.SubMenu, state *StateXML, bluePlayerUrl string) {
+func handleStreamState(app *bitbar.Plugin, submenu *bitbar.SubMenu, state *bluos.StateXML, client *bluos.Client) *bitbar.Line {
 	var icon, icon2 string
 	switch state.Service {
 	case "AirPlay":
@@ -120,13 +235,13 @@ func handleStreamState(app *bitbar.Plugin, submenu *bitbar.SubMenu, state *State
 		icon = ":radio.fill:"
 	}
 
-	cmd := createCommand(fmt.Sprintf("%s/Pause?toggle=1", bluePlayerUrl))
+	cmd := createCommand(client, "toggle")
 	if state.Service == "AirPlay" {
 		if state.Mute == "0" {
-			cmd = createCommand(fmt.Sprintf("%s/Volume?mute=1", bluePlayerUrl))
+			cmd = createCommand(client, "mute")
 			icon2 = ":speaker.wave.1.fill:"
 		} else {
-			cmd = createCommand(fmt.Sprintf("%s/Volume?mute=0", bluePlayerUrl))
+			cmd = createCommand(client, "unmute")
 			icon2 = ":speaker.slash.fill:"
 		}
 	} else {
@@ -143,24 +258,25 @@ func handleStreamState(app *bitbar.Plugin, submenu *bitbar.SubMenu, state *State
 	}
 
 	s1 := fmt.Sprintf("%s %s: %s", icon2, state.ServiceName, state.Title3)
-	submenu.Line(s1).Length(MAX).Command(cmd)
+	line := submenu.Line(s1).Length(MAX).Command(cmd)
 	submenu.Line(state.StreamFormat).Alternate(true)
+	return line
 }
 
 // handlePauseState handles the display for the 'pause' state.
-func handlePauseState(app *bitbar.Plugin, submenu *bitbar.SubMenu, state *StateXML, bluePlayerUrl string) {
+func handlePauseState(app *bitbar.Plugin, submenu *bitbar.SubMenu, state *bluos.StateXML, client *bluos.Client) *bitbar.Line {
 	icon := ":pause.circle.fill:"
 	icon2 := ":play.circle.fill:"
 	l1 := fmt.Sprintf("%s %s", icon, state.Title1)
 	s1 := fmt.Sprintf("%s %s: %s", icon2, state.ServiceName, state.Title1)
 
 	app.StatusLine(l1).DropDown(false).Length(MAX)
-	cmd := createCommand(fmt.Sprintf("%s/Pause?toggle=1", bluePlayerUrl))
-	submenu.Line(s1).Length(MAX).Command(cmd)
+	cmd := createCommand(client, "toggle")
+	return submenu.Line(s1).Length(MAX).Command(cmd)
 }
 
 // handleStopState handles the display for the 'stop' state.
-func handleStopState(app *bitbar.Plugin, submenu *bitbar.SubMenu, state *StateXML, bluePlayerUrl string) {
+func handleStopState(app *bitbar.Plugin, submenu *bitbar.SubMenu, state *bluos.StateXML, client *bluos.Client) *bitbar.Line {
 	icon := ":stop.circle.fill:"
 	icon2 := ":play.circle.fill:"
 	l1 := fmt.Sprintf("%s %s", icon, state.State)
@@ -168,37 +284,82 @@ func handleStopState(app *bitbar.Plugin, submenu *bitbar.SubMenu, state *StateXM
 	app.StatusLine(l1).DropDown(false).Length(MAX)
 
 	if state.Service != "" {
-		cmd := createCommand(fmt.Sprintf("%s/Play", bluePlayerUrl))
+		cmd := createCommand(client, "play")
 		s1 := fmt.Sprintf("%s %s: %s", icon2, state.ServiceName, state.Title1)
-		submenu.Line(s1).Length(MAX).Command(cmd)
+		return submenu.Line(s1).Length(MAX).Command(cmd)
 	}
+	return nil
 }
 
 // handleDefaultState handles the display for any other unhandled state.
-func handleDefaultState(app *bitbar.Plugin, submenu *bitbar.SubMenu, state *StateXML) {
+func handleDefaultState(app *bitbar.Plugin, submenu *bitbar.SubMenu, state *bluos.StateXML) *bitbar.Line {
 	log.Printf("Unhandled player state: %s", state.State)
 	icon := ":questionmark.circle.fill:"
 	l1 := fmt.Sprintf("%s %s", icon, state.State)
 
 	app.StatusLine(l1).DropDown(false).Length(MAX)
-	submenu.Line(fmt.Sprintf("State: %s", state.State))
+	line := submenu.Line(fmt.Sprintf("State: %s", state.State))
 	submenu.Line(fmt.Sprintf("Service: %s", state.Service))
 	submenu.Line(fmt.Sprintf("Title: %s", state.Title1))
+	return line
 }
 
-// addRadioPresets adds radio presets to the menu
-func addRadioPresets(submenu *bitbar.SubMenu, presetsUrl, bluePlayerUrl string) {
-	xmlBytes, err := getXML(presetsUrl)
-	if err != nil {
-		submenu.Line("⚠️ Error loading presets").Color("red")
-		log.Printf("Failed to get presets XML: %v", err)
+// addTransportControls adds next/previous, shuffle, repeat and seek controls.
+// Live streams have no queue to move through, so they only get these while
+// playing or paused from a queue.
+func addTransportControls(submenu *bitbar.SubMenu, client *bluos.Client, state *bluos.StateXML) {
+	if state.State != "play" && state.State != "pause" {
+		return
+	}
+
+	submenu.Line(":forward.fill: Next").Command(createCommand(client, "skip"))
+	submenu.Line(":backward.fill: Previous").Command(createCommand(client, "back"))
+
+	// Shuffle and repeat show their current state and change it on click
+	if state.Shuffle == "1" {
+		submenu.Line(":shuffle: Shuffle: On").Color("blue").Command(createCommand(client, "shuffle", "off"))
+	} else {
+		submenu.Line(":shuffle: Shuffle: Off").Command(createCommand(client, "shuffle", "on"))
+	}
+
+	repeat := bluos.ParseRepeatMode(state.Repeat)
+	repeatIcon := ":repeat:"
+	if repeat == bluos.RepeatOne {
+		repeatIcon = ":repeat.1:"
+	}
+	repeatLine := submenu.Line(fmt.Sprintf("%s Repeat: %s", repeatIcon, repeat)).Command(createCommand(client, "repeat", "cycle"))
+	if repeat != bluos.RepeatOff {
+		repeatLine.Color("blue")
+	}
+
+	if state.CanSeek != "1" {
 		return
 	}
+	submenu.Line(":goforward: Seek")
+	seek := submenu.NewSubMenu()
+	seek.Line(":gobackward.30: Back 30s").Command(createCommand(client, "seek", "-30"))
+	seek.Line(":goforward.30: Forward 30s").Command(createCommand(client, "seek", "+30"))
+	if totlen, _ := strconv.Atoi(state.Totlen); totlen > 0 {
+		for _, pct := range []int{0, 25, 50, 75} {
+			seek.Line(fmt.Sprintf(":arrow.right.to.line: Jump to %d%%", pct)).Command(createCommand(client, "seek", fmt.Sprintf("%d%%", pct)))
+		}
+	}
+}
 
-	var presets Presets
-	if err := xml.Unmarshal(xmlBytes, &presets); err != nil {
+// addRadioPresets adds radio presets to the menu with the playing one checked,
+// followed by next and previous preset
+func addRadioPresets(submenu *bitbar.SubMenu, client *bluos.Client, state *bluos.StateXML, presets *bluos.Presets, presetsErr *SectionError) {
+	if presetsErr != nil && presetsErr.Timeout {
+		submenu.Line(":hourglass: Presets not loaded in time").Color("gray")
+		log.Printf("Presets missed the deadline: %s", presetsErr.Message)
+		return
+	} else if presetsErr != nil && presetsErr.Parse {
 		submenu.Line("⚠️ Error parsing presets").Color("red")
-		log.Printf("Failed to parse presets XML: %v", err)
+		log.Printf("Failed to parse presets XML: %s", presetsErr.Message)
+		return
+	} else if presetsErr != nil || presets == nil {
+		submenu.Line("⚠️ Error loading presets").Color("red")
+		log.Printf("Failed to get presets XML: %v", presetsErr)
 		return
 	}
 
@@ -206,14 +367,26 @@ func addRadioPresets(submenu *bitbar.SubMenu, presetsUrl, bluePlayerUrl string)
 	log.Printf("Adding %d radio presets", len(presets.Preset))
 	for _, p := range presets.Preset {
 		// Use SF Symbol for each preset, matching the previous implementation
-		l := fmt.Sprintf(":star.fill: %s - %s", p.ID, p.Name)
-		c := fmt.Sprintf("%s/Preset?id=%s", bluePlayerUrl, p.ID)
-		cmd := createCommand(c)
-		submenu.Line(l).Command(cmd)
+		symbol := ":star.fill:"
+		if state != nil && state.PresetID != "" && state.PresetID == p.ID {
+			symbol = ":checkmark:"
+		}
+		l := fmt.Sprintf("%s %s - %s", symbol, p.ID, p.Name)
+		cmd := createCommand(client, "preset", p.ID)
+		line := submenu.Line(l).Command(cmd)
+		if img := artworkImage(client, p.Image, presetArtSize); img != nil {
+			line.Image(img)
+		}
+		// Hold ⌥ to cross-fade instead of switching at once
+		submenu.Line(fmt.Sprintf(":arrow.left.arrow.right: Cross-fade to %s - %s", p.ID, p.Name)).Alternate(true).
+			Command(createCommand(client, "fade", "preset", p.ID))
 	}
 
 	if len(presets.Preset) == 0 {
 		submenu.Line("No presets found").Color("gray")
+	} else if len(presets.Preset) > 1 {
+		submenu.Line(":forward.fill: Next preset").Command(createCommand(client, "preset", "next"))
+		submenu.Line(":backward.fill: Previous preset").Command(createCommand(client, "preset", "prev"))
 	}
 }
 
@@ -253,38 +426,28 @@ func getVolumeColor(level int) string {
 	}
 }
 
-func addVolumeInfo(submenu *bitbar.SubMenu, bluePlayerUrl string) *VolumeStatus {
+func addVolumeInfo(submenu *bitbar.SubMenu, client *bluos.Client, volStatus *bluos.VolumeStatus, volumeErr *SectionError) *bluos.VolumeStatus {
 	log.Printf("Getting volume info")
-	volumeUrl := fmt.Sprintf("%s/Volume", bluePlayerUrl)
-	xmlBytes, err := getXML(volumeUrl)
-	if err != nil {
-		submenu.Line("⚠️ Could not get volume").Color("red")
-		log.Printf("Failed to get volume XML: %v", err)
+	if volumeErr != nil && volumeErr.Timeout {
+		submenu.Line(":hourglass: Volume not loaded in time").Color("gray")
+		log.Printf("Volume missed the deadline: %s", volumeErr.Message)
 		return nil
-	}
-
-	// Log the volume XML response for debugging
-	if len(xmlBytes) > 0 {
-		previewLength := 200
-		if len(xmlBytes) < previewLength {
-			previewLength = len(xmlBytes)
-		}
-		log.Printf("Volume XML response preview: %s", string(xmlBytes[:previewLength]))
-	}
-
-	var volStatus VolumeStatus
-	if err := xml.Unmarshal(xmlBytes, &volStatus); err != nil {
+	} else if volumeErr != nil && volumeErr.Parse {
 		submenu.Line("⚠️ Error parsing volume data").Color("red")
-		log.Printf("Failed to parse volume XML: %v", err)
+		log.Printf("Failed to parse volume XML: %s", volumeErr.Message)
 
 		// Try to create a default volume object so the UI doesn't completely fail
 		log.Printf("Creating default volume status object")
-		return &VolumeStatus{
+		return &bluos.VolumeStatus{
 			Db:    -30.0, // Default reasonable value
 			Mute:  0,
 			Level: 50, // Default reasonable value
 			Etag:  "unknown",
 		}
+	} else if volumeErr != nil || volStatus == nil {
+		submenu.Line("⚠️ Could not get volume").Color("red")
+		log.Printf("Failed to get volume XML: %v", volumeErr)
+		return nil
 	}
 
 	log.Printf("Current volume: %d%%, %.1f dB, Muted: %v", volStatus.Level, volStatus.Db, volStatus.Mute == 1)
@@ -309,18 +472,19 @@ func addVolumeInfo(submenu *bitbar.SubMenu, bluePlayerUrl string) *VolumeStatus
 
 		// Fine volume control as alternate lines
 		submenu.Line(":speaker.wave.3.fill: Volume Up (1dB)").Command(
-			createVolumeCommand(bluePlayerUrl, map[string]string{"db": "1.0"}),
+			createCommand(client, "volume", "--db", "1.0"),
 		).Alternate(true)
 		submenu.Line(":speaker.wave.1.fill: Volume Down (1dB)").Command(
-			createVolumeCommand(bluePlayerUrl, map[string]string{"db": "-1.0"}),
+			createCommand(client, "volume", "--db", "-1.0"),
 		).Alternate(true)
 	}
 
-	return &volStatus
+	return volStatus
 }
 
-// addVolumePresets adds volume preset buttons to the menu
-func addVolumePresets(submenu *bitbar.SubMenu, bluePlayerUrl string, volStatus *VolumeStatus) {
+// addVolumePresets adds volume preset buttons to the menu, leaving out those
+// above the volume limit
+func addVolumePresets(submenu *bitbar.SubMenu, client *bluos.Client, volStatus *bluos.VolumeStatus, limit volumeLimit) {
 	if volStatus == nil {
 		return
 	}
@@ -328,20 +492,28 @@ func addVolumePresets(submenu *bitbar.SubMenu, bluePlayerUrl string, volStatus *
 	log.Printf("Adding volume presets")
 
 	// Volume presets in descending order
-	volumePresets := []struct {
+	type volumePreset struct {
 		Label string
 		Level int
-	}{
+	}
+	volumePresets := []volumePreset{
 		{":megaphone.fill: Max (100%)", 100},
 		{":speaker.wave.3.fill: High (80%)", 80},
 		{":speaker.wave.2.fill: Medium (60%)", 60},
 		{":speaker.wave.1.fill: Low (40%)", 40},
 	}
 
+	// Presets at or above the cap are left out; the cap itself takes their place
+	if limit.active() {
+		volumePresets = slices.DeleteFunc(volumePresets, func(p volumePreset) bool { return p.Level >= limit.Level })
+		label := fmt.Sprintf("%s Limit (%d%%, %s)", getVolumeSymbol(limit.Level, false), limit.Level, limit.Reason)
+		volumePresets = slices.Insert(volumePresets, 0, volumePreset{label, limit.Level})
+	}
+
 	// Highlight the current preset that's closest to the current volume
 	currentVol := volStatus.Level
 	for _, preset := range volumePresets {
-		presetCmd := createVolumeCommand(bluePlayerUrl, map[string]string{"level": strconv.Itoa(preset.Level)})
+		presetCmd := createCommand(client, "volume", "--level", strconv.Itoa(preset.Level))
 		line := submenu.Line(preset.Label).Command(presetCmd)
 
 		// Highlight if this is the active preset (within 5%)
@@ -352,16 +524,16 @@ func addVolumePresets(submenu *bitbar.SubMenu, bluePlayerUrl string, volStatus *
 }
 
 // addMuteToggle adds the mute/unmute toggle button
-func addMuteToggle(submenu *bitbar.SubMenu, bluePlayerUrl string, volStatus *VolumeStatus) {
+func addMuteToggle(submenu *bitbar.SubMenu, client *bluos.Client, volStatus *bluos.VolumeStatus) {
 	if volStatus == nil {
 		return
 	}
 
 	if volStatus.Mute == 1 {
-		unmuteCmd := createVolumeCommand(bluePlayerUrl, map[string]string{"mute": "0"})
+		unmuteCmd := createCommand(client, "unmute")
 		submenu.Line(":speaker.wave.2.fill: Unmute").Command(unmuteCmd)
 	} else {
-		muteCmd := createVolumeCommand(bluePlayerUrl, map[string]string{"mute": "1"})
+		muteCmd := createCommand(client, "mute")
 		submenu.Line(":speaker.slash.fill: Mute").Command(muteCmd)
 	}
 }
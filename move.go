@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"BlueOS/bluos"
+	"github.com/johnmccabe/go-bitbar"
+)
+
+// maxMovedEntries is how many queue entries, starting at the current song,
+// are replayed on the target when the player cannot move playback itself
+const maxMovedEntries = 50
+
+// canMovePlayback reports whether the player offers to hand playback to another room
+func canMovePlayback(state *bluos.StateXML) bool {
+	return state.CanMovePlayback == "true" || state.CanMovePlayback == "1"
+}
+
+// addMoveMenu adds a "Move playback to…" submenu listing the rooms outside
+// the player's group
+func addMoveMenu(submenu *bitbar.SubMenu, client *bluos.Client, state *bluos.StateXML, rooms []room) {
+	if !canMovePlayback(state) || len(rooms) < 2 {
+		return
+	}
+	group, err := groupOf(rooms, roomAddress(client.BaseURL))
+	if err != nil || len(group.Others) == 0 {
+		return
+	}
+
+	submenu.Line(":arrow.right.circle: Move playback to…")
+	moveMenu := submenu.NewSubMenu()
+	for _, r := range group.Others {
+		moveMenu.Line(r.Sync.Name).Length(MAX).Command(createCommand(client, "move", r.URL))
+	}
+}
+
+// cmdMove moves playback to another room. When the player rejects the native
+// move, the source, queue position and volume are replayed on the target and
+// the player is stopped.
+func cmdMove(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	if len(args) == 0 {
+		return nil, errors.New("usage: move <room>")
+	}
+
+	status, err := client.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rooms, err := loadRooms(ctx, client, status.SyncStat)
+	if err != nil {
+		return nil, err
+	}
+	group, err := groupOf(rooms, roomAddress(client.BaseURL))
+	if err != nil {
+		return nil, err
+	}
+	target, err := findRoomByName(group.Others, strings.Join(args, " "))
+	if err != nil {
+		return nil, err
+	}
+
+	if canMovePlayback(status) {
+		err := client.MovePlayback(ctx, target.address())
+		if err == nil {
+			return messageResult{fmt.Sprintf("Moved playback to %s", target.Sync.Name)}, nil
+		}
+		var statusErr *bluos.StatusError
+		if !errors.As(err, &statusErr) {
+			return nil, err
+		}
+		log.Printf("Native move to %s unavailable, replaying instead: %v", target.Sync.Name, err)
+	}
+
+	if err := replayPlayback(ctx, client, bluos.NewClient(target.URL), status); err != nil {
+		return nil, fmt.Errorf("replay on %s: %w", target.Sync.Name, err)
+	}
+	return messageResult{fmt.Sprintf("Moved playback to %s (replayed)", target.Sync.Name)}, nil
+}
+
+// replayPlayback starts what source is playing on target: the same volume,
+// then either the same stream or the rest of the queue from the current
+// position. source is stopped once target plays.
+func replayPlayback(ctx context.Context, source, target *bluos.Client, status *bluos.StateXML) error {
+	// Set the volume first so the target does not start at its own level
+	if vol, err := source.Volume(ctx); err == nil {
+		if _, err := setLimitedVolume(ctx, target, vol.Level); err != nil {
+			return err
+		}
+	} else {
+		log.Printf("Could not read source volume, keeping target volume: %v", err)
+	}
+
+	if status.StreamUrl != "" {
+		if _, err := target.PlayURL(ctx, status.StreamUrl); err != nil {
+			return err
+		}
+	} else if err := replayQueue(ctx, source, target, status); err != nil {
+		return err
+	}
+
+	_, err := source.Stop(ctx)
+	return err
+}
+
+// replayQueue copies the queue from the current song on to target and
+// resumes at the same position in the track
+func replayQueue(ctx context.Context, source, target *bluos.Client, status *bluos.StateXML) error {
+	song, _ := strconv.Atoi(status.Song)
+	queue, err := source.Playlist(ctx, song, song+maxMovedEntries-1)
+	if err != nil {
+		return err
+	}
+
+	var files []string
+	for _, s := range queue.Songs {
+		if s.File != "" {
+			files = append(files, s.File)
+		}
+	}
+	if len(files) == 0 {
+		return errors.New("nothing to move: no stream and no queued tracks")
+	}
+
+	if err := target.ClearQueue(ctx); err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := target.AddToQueue(ctx, file); err != nil {
+			return err
+		}
+	}
+	if _, err := target.PlayQueueEntry(ctx, 0); err != nil {
+		return err
+	}
+	if secs, _ := strconv.Atoi(status.Secs); secs > 0 && status.CanSeek == "1" {
+		if _, err := target.Seek(ctx, secs); err != nil {
+			log.Printf("Could not resume at %s: %v", formatDuration(secs), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"BlueOS/bluos"
+	"github.com/johnmccabe/go-bitbar"
+)
+
+// addPlayersMenu adds a Players submenu listing every room, with a checkmark
+// on the one the menu controls. Picking another room makes it the active player.
+func addPlayersMenu(submenu *bitbar.SubMenu, client *bluos.Client, rooms []room) {
+	if len(rooms) < 2 {
+		return
+	}
+	active := findRoom(rooms, roomAddress(client.BaseURL))
+	if active == nil {
+		return
+	}
+
+	submenu.Line(":hifispeaker.and.homepod: Player: " + active.Sync.Name).Length(MAX)
+	playersMenu := submenu.NewSubMenu()
+
+	name, pinned := preferredPlayerName()
+	if pinned {
+		playersMenu.Line(fmt.Sprintf("Pinned to %q by BLUE_PLAYER_NAME", name)).Color("gray").Length(MAX)
+	}
+	for _, r := range rooms {
+		switch {
+		case r.URL == active.URL:
+			playersMenu.Line(":checkmark: " + r.Sync.Name).Length(MAX)
+		case pinned:
+			playersMenu.Line(r.Sync.Name).Color("gray").Length(MAX)
+		default:
+			playersMenu.Line(r.Sync.Name).Length(MAX).Command(createCommand(client, "player", r.URL))
+		}
+	}
+}
+
+// playerList is the output of the player command without arguments
+type playerList struct {
+	Active string     `json:"active"`
+	Pinned bool       `json:"pinned"` // Set when BLUE_PLAYER_NAME decides the player
+	Rooms  []roomInfo `json:"rooms"`
+}
+
+func (l playerList) String() string {
+	lines := make([]string, len(l.Rooms))
+	for i, r := range l.Rooms {
+		marker := " "
+		if r.URL == l.Active {
+			marker = "*"
+		}
+		lines[i] = fmt.Sprintf("%s %-20s %s", marker, r.Name, r.URL)
+	}
+	if l.Pinned {
+		lines = append(lines, "(pinned by BLUE_PLAYER_NAME)")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// cmdPlayer lists the rooms or makes one of them the active player. The
+// choice is kept in the state file and used by later runs.
+func cmdPlayer(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	status, err := client.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rooms, err := loadRooms(ctx, client, status.SyncStat)
+	if err != nil {
+		return nil, err
+	}
+
+	name, pinned := preferredPlayerName()
+	if len(args) == 0 || (len(args) == 1 && args[0] == "list") {
+		return playerList{Active: client.BaseURL, Pinned: pinned, Rooms: newRoomInfos(rooms)}, nil
+	}
+	if pinned {
+		return nil, fmt.Errorf("the player is pinned to %q by BLUE_PLAYER_NAME", name)
+	}
+
+	r, err := findRoomByName(rooms, strings.Join(args, " "))
+	if err != nil {
+		return nil, err
+	}
+	if err := updateState(func(state *pluginState) {
+		state.PlayerURL, state.PlayerName = r.URL, r.Sync.Name
+	}); err != nil {
+		return nil, fmt.Errorf("save player choice: %w", err)
+	}
+	// Point the discovery cache at the new player so the next refresh uses it
+	rememberDevice(ctx, r.URL, currentNetworkID())
+	return messageResult{fmt.Sprintf("Active player: %s", r.Sync.Name)}, nil
+}
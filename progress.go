@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"BlueOS/bluos"
+	"github.com/johnmccabe/go-bitbar"
+)
+
+const progressBarWidth = 14 // Characters in the track progress bar
+
+// trackPosition returns the elapsed and total seconds of the current track.
+// /Status only reports secs when it is fetched, so while playing the time
+// since then is added; total is 0 for live streams.
+func trackPosition(state *bluos.StateXML, fetchedAt time.Time) (elapsed, total int) {
+	elapsed, _ = strconv.Atoi(state.Secs)
+	total, _ = strconv.Atoi(state.Totlen)
+	if (state.State == "play" || state.State == "stream") && !fetchedAt.IsZero() {
+		elapsed += int(time.Since(fetchedAt).Seconds())
+	}
+	if total > 0 {
+		elapsed = min(elapsed, total)
+	}
+	return elapsed, total
+}
+
+// progressBar draws elapsed/total as a bar of filled and empty blocks
+func progressBar(elapsed, total int) string {
+	filled := min(progressBarWidth, elapsed*progressBarWidth/total)
+	return strings.Repeat("▰", filled) + strings.Repeat("▱", progressBarWidth-filled)
+}
+
+// addTrackProgress adds the elapsed and remaining time with a progress bar.
+// Live streams have no length, so they only show how long they have been playing.
+func addTrackProgress(submenu *bitbar.SubMenu, state *bluos.StateXML, fetchedAt time.Time) {
+	elapsed, total := trackPosition(state, fetchedAt)
+	switch {
+	case total > 0:
+		line := fmt.Sprintf("%s %s -%s", formatDuration(elapsed), progressBar(elapsed, total), formatDuration(total-elapsed))
+		submenu.Line(line).Color("gray")
+		submenu.Line(fmt.Sprintf("%s of %s (%d%%)", formatDuration(elapsed), formatDuration(total), elapsed*100/total)).Color("gray").Alternate(true)
+	case elapsed > 0:
+		submenu.Line(fmt.Sprintf(":dot.radiowaves.left.and.right: Live · %s", formatDuration(elapsed))).Color("gray")
+	}
+}
+
+// addProgressStatusLine adds the track time to the cycling status lines when
+// BLUE_SHOW_TIME is set in .env
+func addProgressStatusLine(app *bitbar.Plugin, state *bluos.StateXML, fetchedAt time.Time) {
+	if show, _ := strconv.ParseBool(myConfig["BLUE_SHOW_TIME"]); !show || state.State != "play" {
+		return
+	}
+	elapsed, total := trackPosition(state, fetchedAt)
+	if total > 0 {
+		app.StatusLine(fmt.Sprintf(":timer: %s / %s", formatDuration(elapsed), formatDuration(total))).DropDown(false)
+	} else if elapsed > 0 {
+		app.StatusLine(fmt.Sprintf(":timer: %s", formatDuration(elapsed))).DropDown(false)
+	}
+}
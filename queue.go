@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"BlueOS/bluos"
+	"github.com/johnmccabe/go-bitbar"
+)
+
+const (
+	maxQueueEntries = 500 // Entries fetched and cached around the current song
+	queueWindowSize = 10  // Entries shown around the current song
+	queuePageSize   = 25  // Entries per page in the "All tracks" submenu
+)
+
+// queueCache stores the play queue of one player for one playlist id
+type queueCache struct {
+	URL      string          `json:"url"`
+	Pid      string          `json:"pid"`
+	Playlist *bluos.Playlist `json:"playlist"`
+}
+
+// queueCachePath returns the location of the play queue cache
+func queueCachePath() string {
+	return tmpPath("blueos-queue.json")
+}
+
+// loadQueue returns up to maxQueueEntries of the play queue for pid, around
+// the current song. The queue is only fetched from the player when the cached
+// copy belongs to another playlist id, since BluOS assigns a new id whenever
+// the queue changes, or when the current song has moved out of it.
+func loadQueue(ctx context.Context, client *bluos.Client, pid, song string) (*bluos.Playlist, error) {
+	if pid == "" {
+		return nil, nil
+	}
+	current, _ := strconv.Atoi(song)
+
+	if data, err := os.ReadFile(queueCachePath()); err == nil {
+		var cache queueCache
+		if err := json.Unmarshal(data, &cache); err == nil && cache.URL == client.BaseURL && cache.Pid == pid && queueCovers(cache.Playlist, current) {
+			log.Printf("Using cached queue for playlist %s", pid)
+			return cache.Playlist, nil
+		}
+	}
+
+	log.Printf("Fetching queue for playlist %s around entry %d", pid, current+1)
+	playlist, err := fetchQueue(ctx, client, current)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(queueCache{URL: client.BaseURL, Pid: pid, Playlist: playlist})
+	if err == nil {
+		err = os.WriteFile(queueCachePath(), data, 0o600)
+	}
+	if err != nil {
+		log.Printf("Failed to cache queue: %v", err)
+	}
+	return playlist, nil
+}
+
+// fetchQueue fetches maxQueueEntries entries of the play queue centred on
+// current. Near the end of the queue the window is short, so the page before
+// it is fetched as well to fill it up.
+func fetchQueue(ctx context.Context, client *bluos.Client, current int) (*bluos.Playlist, error) {
+	start := max(0, current-maxQueueEntries/2)
+	playlist, err := client.Playlist(ctx, start, start+maxQueueEntries-1)
+	if err != nil || start == 0 || len(playlist.Songs) >= maxQueueEntries {
+		return playlist, err
+	}
+
+	first := max(0, min(start, playlist.Length)-(maxQueueEntries-len(playlist.Songs)))
+	earlier, err := client.Playlist(ctx, first, start-1)
+	if err != nil {
+		return nil, err
+	}
+	playlist.Songs = append(earlier.Songs, playlist.Songs...)
+	return playlist, nil
+}
+
+// queueCovers reports whether a fetched part of the queue still holds the
+// entries shown around the current song
+func queueCovers(queue *bluos.Playlist, current int) bool {
+	if queue == nil || len(queue.Songs) == 0 {
+		return queue != nil && queue.Length == 0
+	}
+	first, last := queue.Songs[0].ID, queue.Songs[len(queue.Songs)-1].ID
+	return (first == 0 || current-first >= queueWindowSize) &&
+		(last >= queue.Length-1 || last-current >= queueWindowSize)
+}
+
+// addQueueMenu adds a Queue submenu paged around the current song, with the
+// current track highlighted and actions to jump to, remove or move entries
+func addQueueMenu(submenu *bitbar.SubMenu, client *bluos.Client, state *bluos.StateXML, queue *bluos.Playlist) {
+	if queue == nil || len(queue.Songs) == 0 {
+		return
+	}
+	songs := queue.Songs
+	current, _ := strconv.Atoi(state.Song)
+	// Index of the current song in the fetched entries, which need not start at 0
+	index := current - songs[0].ID
+
+	submenu.Line(fmt.Sprintf(":list.number: Queue (%d)", queue.Length))
+	queueMenu := submenu.NewSubMenu()
+
+	// Window of entries around the current song
+	start := max(0, min(index-2, len(songs)-queueWindowSize))
+	end := min(len(songs), start+queueWindowSize)
+	for _, song := range songs[start:end] {
+		addQueueEntry(queueMenu, client, song, song.ID == current)
+	}
+
+	// Every fetched entry, split into pages
+	if len(songs) > queueWindowSize {
+		queueMenu.Line("---")
+		queueMenu.Line(":list.bullet: All tracks")
+		pages := queueMenu.NewSubMenu()
+		if earlier := songs[0].ID; earlier > 0 {
+			pages.Line(fmt.Sprintf("… %d earlier not shown", earlier)).Color("gray")
+		}
+		for first := 0; first < len(songs); first += queuePageSize {
+			last := min(first+queuePageSize, len(songs))
+			pages.Line(fmt.Sprintf("Tracks %d–%d", songs[first].ID+1, songs[last-1].ID+1))
+			page := pages.NewSubMenu()
+			for _, song := range songs[first:last] {
+				addQueueEntry(page, client, song, song.ID == current)
+			}
+		}
+	}
+	if later := queue.Length - songs[len(songs)-1].ID - 1; later > 0 {
+		queueMenu.Line(fmt.Sprintf("… %d more not shown", later)).Color("gray")
+	}
+
+	// Reordering actions for the entries in the window
+	queueMenu.Line("---")
+	queueMenu.Line(":arrow.up.arrow.down: Edit queue")
+	edit := queueMenu.NewSubMenu()
+	for _, song := range songs[start:end] {
+		edit.Line(queueEntryLabel(song)).Length(MAX)
+		actions := edit.NewSubMenu()
+		pos := strconv.Itoa(song.ID + 1)
+		if song.ID > 0 {
+			actions.Line(":arrow.up: Move up").Command(createCommand(client, "queue", "move", pos, strconv.Itoa(song.ID)))
+		}
+		if song.ID < queue.Length-1 {
+			actions.Line(":arrow.down: Move down").Command(createCommand(client, "queue", "move", pos, strconv.Itoa(song.ID+2)))
+		}
+		if next := playNextPosition(song.ID, current); song.ID != current && next != song.ID {
+			actions.Line(":text.line.first.and.arrowtriangle.forward: Play next").Command(createCommand(client, "queue", "move", pos, strconv.Itoa(next+1)))
+		}
+		actions.Line(":trash: Remove").Command(createCommand(client, "queue", "delete", pos))
+	}
+	queueMenu.Line(":trash: Clear queue").Color("red").Command(createCommand(client, "queue", "clear"))
+}
+
+// addQueueEntry adds one queue line that jumps to the entry, with a remove
+// action on the ⌥ alternate line
+func addQueueEntry(menu *bitbar.SubMenu, client *bluos.Client, song bluos.PlaylistSong, isCurrent bool) {
+	pos := strconv.Itoa(song.ID + 1)
+	label := queueEntryLabel(song)
+	if isCurrent {
+		menu.Line(":speaker.wave.2.fill: " + label).Color("blue").Length(MAX).Command(createCommand(client, "queue", "play", pos))
+	} else {
+		menu.Line(label).Length(MAX).Command(createCommand(client, "queue", "play", pos))
+	}
+	menu.Line(":trash: Remove " + label).Alternate(true).Length(MAX).Command(createCommand(client, "queue", "delete", pos))
+}
+
+// queueEntryLabel formats a queue entry as "3. Title – Artist"
+func queueEntryLabel(song bluos.PlaylistSong) string {
+	if song.Artist == "" {
+		return fmt.Sprintf("%d. %s", song.ID+1, song.Title)
+	}
+	return fmt.Sprintf("%d. %s – %s", song.ID+1, song.Title, song.Artist)
+}
+
+// playNextPosition returns the queue index an entry must move to so it plays
+// right after the current song. Moving an earlier entry shifts the current song up.
+func playNextPosition(id, current int) int {
+	if id < current {
+		return current
+	}
+	return current + 1
+}
+
+// queueResult is the output of the queue command
+type queueResult struct {
+	Current int                  `json:"current"` // 1-based position of the current song
+	Length  int                  `json:"length"`
+	Songs   []bluos.PlaylistSong `json:"songs"`
+}
+
+func (r queueResult) String() string {
+	if len(r.Songs) == 0 {
+		return "Queue is empty"
+	}
+	lines := make([]string, len(r.Songs))
+	for i, song := range r.Songs {
+		marker := "  "
+		if song.ID+1 == r.Current {
+			marker = "▶ "
+		}
+		lines[i] = marker + queueEntryLabel(song)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// cmdQueue lists or edits the play queue. Positions are 1-based, as displayed.
+func cmdQueue(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	action := "list"
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+
+	positions := make([]int, len(args))
+	for i, arg := range args {
+		pos, err := strconv.Atoi(arg)
+		if err != nil || pos < 1 {
+			return nil, fmt.Errorf("invalid queue position %q", arg)
+		}
+		positions[i] = pos - 1
+	}
+
+	switch {
+	case action == "list" && len(positions) == 0:
+		status, err := client.Status(ctx)
+		if err != nil {
+			return nil, err
+		}
+		queue, err := loadQueue(ctx, client, status.Pid, status.Song)
+		if err != nil {
+			return nil, err
+		}
+		current, _ := strconv.Atoi(status.Song)
+		result := queueResult{Current: current + 1}
+		if queue != nil {
+			result.Length, result.Songs = queue.Length, queue.Songs
+		}
+		return result, nil
+	case action == "play" && len(positions) == 1:
+		return stateCommand(client.PlayQueueEntry(ctx, positions[0]))
+	case action == "delete" && len(positions) == 1:
+		return messageCommand(fmt.Sprintf("Removed entry %d", positions[0]+1), client.DeleteQueueEntry(ctx, positions[0]))
+	case action == "move" && len(positions) == 2:
+		return messageCommand(fmt.Sprintf("Moved entry %d to %d", positions[0]+1, positions[1]+1), client.MoveQueueEntry(ctx, positions[0], positions[1]))
+	case action == "clear" && len(positions) == 0:
+		return messageCommand("Queue cleared", client.ClearQueue(ctx))
+	default:
+		return nil, errors.New("usage: queue [list | play <n> | delete <n> | move <from> <to> | clear]")
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"BlueOS/bluos"
+	"github.com/johnmccabe/go-bitbar"
+)
+
+// scene is a named list of steps from the scenes file, run in order
+type scene struct {
+	Name  string      `json:"name"`
+	Steps []sceneStep `json:"steps"`
+}
+
+// sceneStep does exactly one thing. Steps go through the same commands as
+// the menu, so volume limits and preset names work as there.
+type sceneStep struct {
+	Preset  string   `json:"preset,omitempty"` // Preset id or name
+	URL     string   `json:"url,omitempty"`    // Stream to play, as for favourites
+	Volume  *int     `json:"volume,omitempty"`
+	Mute    *bool    `json:"mute,omitempty"`
+	Group   []string `json:"group,omitempty"` // Rooms to add to the group of the player
+	Ungroup bool     `json:"ungroup,omitempty"`
+	Shuffle string   `json:"shuffle,omitempty"` // on or off
+	Repeat  string   `json:"repeat,omitempty"`  // off, all or one
+	Wait    duration `json:"wait,omitempty"`
+}
+
+// scenesPath returns the location of the scenes file, which is edited by hand
+func scenesPath() string {
+	return configPath("scenes.json")
+}
+
+// loadScenes reads the scenes file. A missing file yields no scenes.
+func loadScenes() ([]scene, error) {
+	data, err := os.ReadFile(scenesPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var scenes []scene
+	if err := json.Unmarshal(data, &scenes); err != nil {
+		return nil, fmt.Errorf("read %s: %w", scenesPath(), err)
+	}
+	return scenes, nil
+}
+
+// sceneAction is what a step runs, described the way the command line would
+type sceneAction struct {
+	label  string
+	run    func(ctx context.Context, client *bluos.Client) (any, error)
+	starts bool // Starts playback, so the volume steps that follow apply to it
+}
+
+// action returns what a step does, or an error unless it does exactly one thing
+func (s sceneStep) action() (sceneAction, error) {
+	var actions []sceneAction
+	add := func(set bool, label string, run func(ctx context.Context, client *bluos.Client) (any, error)) {
+		if set {
+			actions = append(actions, sceneAction{label: label, run: run})
+		}
+	}
+	command := func(fn func(ctx context.Context, client *bluos.Client, args []string) (any, error), args ...string) func(ctx context.Context, client *bluos.Client) (any, error) {
+		return func(ctx context.Context, client *bluos.Client) (any, error) { return fn(ctx, client, args) }
+	}
+
+	add(s.Preset != "", "preset "+s.Preset, command(cmdPreset, s.Preset))
+	add(s.URL != "", "play "+s.URL, func(ctx context.Context, client *bluos.Client) (any, error) {
+		if _, err := client.PlayURL(ctx, s.URL); err != nil {
+			return nil, err
+		}
+		return messageResult{fmt.Sprintf("Playing %s", s.URL)}, nil
+	})
+	if s.Volume != nil {
+		add(true, fmt.Sprintf("volume %d", *s.Volume), command(cmdVolume, "--level", strconv.Itoa(*s.Volume)))
+	}
+	if s.Mute != nil {
+		if *s.Mute {
+			add(true, "mute", command(cmdMute))
+		} else {
+			add(true, "unmute", command(cmdUnmute))
+		}
+	}
+	add(len(s.Group) > 0, "group "+strings.Join(s.Group, ", "), func(ctx context.Context, client *bluos.Client) (any, error) {
+		return groupRooms(ctx, client, s.Group)
+	})
+	add(s.Ungroup, "ungroup", command(cmdGroup, "ungroup"))
+	add(s.Shuffle != "", "shuffle "+s.Shuffle, command(cmdShuffle, s.Shuffle))
+	add(s.Repeat != "", "repeat "+s.Repeat, command(cmdRepeat, s.Repeat))
+	add(s.Wait > 0, "wait "+time.Duration(s.Wait).String(), func(ctx context.Context, client *bluos.Client) (any, error) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Duration(s.Wait)):
+			return messageResult{"Done"}, nil
+		}
+	})
+
+	switch len(actions) {
+	case 0:
+		return sceneAction{}, errors.New("step does nothing")
+	case 1:
+		actions[0].starts = s.Preset != "" || s.URL != ""
+		return actions[0], nil
+	default:
+		labels := make([]string, len(actions))
+		for i, a := range actions {
+			labels[i] = a.label
+		}
+		return sceneAction{}, fmt.Errorf("step does several things (%s), split it", strings.Join(labels, ", "))
+	}
+}
+
+// groupRooms adds rooms to the group of the player, skipping those already in it
+func groupRooms(ctx context.Context, client *bluos.Client, names []string) (any, error) {
+	status, err := client.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rooms, err := loadRooms(ctx, client, status.SyncStat)
+	if err != nil {
+		return nil, err
+	}
+	group, err := groupOf(rooms, roomAddress(client.BaseURL))
+	if err != nil {
+		return nil, err
+	}
+	grouped := append([]room{group.Leader}, group.Members...)
+
+	var messages []string
+	for _, name := range names {
+		if r, err := findRoomByName(grouped, name); err == nil {
+			messages = append(messages, fmt.Sprintf("%s already grouped", r.Sync.Name))
+			continue
+		}
+		result, err := cmdGroup(ctx, client, []string{"add", name})
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, fmt.Sprint(result))
+	}
+	return messageResult{strings.Join(messages, ", ")}, nil
+}
+
+// addScenesMenu adds a Scenes submenu with a line per scene from the scenes file
+func addScenesMenu(submenu *bitbar.SubMenu, client *bluos.Client) {
+	scenes, err := loadScenes()
+	if err != nil {
+		log.Printf("Scenes unavailable: %v", err)
+		submenu.Line("⚠️ Error loading scenes").Color("red")
+		return
+	}
+	if len(scenes) == 0 {
+		return
+	}
+
+	log.Printf("Adding %d scenes", len(scenes))
+	submenu.Line(":sparkles: Scenes")
+	scenesMenu := submenu.NewSubMenu()
+	for i, s := range scenes {
+		scenesMenu.Line(s.Name).Length(MAX).Command(createCommand(client, "scene", strconv.Itoa(i+1)))
+	}
+}
+
+// sceneStepResult reports a step of a scene that ran
+type sceneStepResult struct {
+	N      int    `json:"n"`
+	Step   string `json:"step"`
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// sceneResult is the output of the scene command: every step that ran, the
+// last one with its error when the scene stopped early
+type sceneResult struct {
+	Scene string            `json:"scene"`
+	Steps []sceneStepResult `json:"steps"`
+	Total int               `json:"total"`
+}
+
+func (r sceneResult) String() string {
+	lines := []string{r.Scene + ":"}
+	for _, s := range r.Steps {
+		if s.Error != "" {
+			lines = append(lines, fmt.Sprintf("✗ %d. %s: %s", s.N, s.Step, s.Error))
+		} else {
+			lines = append(lines, fmt.Sprintf("✓ %d. %s: %s", s.N, s.Step, s.Result))
+		}
+	}
+	if n := len(r.Steps); n > 0 && r.Steps[n-1].Error != "" {
+		lines = append(lines, fmt.Sprintf("Stopped at step %d of %d", n, r.Total))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// sceneList is the output of the scene command without arguments
+type sceneList struct {
+	Path   string   `json:"path"`
+	Scenes []string `json:"scenes"`
+}
+
+func (l sceneList) String() string {
+	if len(l.Scenes) == 0 {
+		return fmt.Sprintf("No scenes in %s", l.Path)
+	}
+	lines := make([]string, len(l.Scenes))
+	for i, name := range l.Scenes {
+		lines[i] = fmt.Sprintf("%2d  %s", i+1, name)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// cmdScene lists the scenes, or runs one step by step and stops at the first
+// step that fails. The result reports every step that ran, also on failure.
+func cmdScene(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	scenes, err := loadScenes()
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 || (len(args) == 1 && args[0] == "list") {
+		list := sceneList{Path: scenesPath(), Scenes: []string{}}
+		for _, s := range scenes {
+			list.Scenes = append(list.Scenes, s.Name)
+		}
+		return list, nil
+	}
+
+	s, err := findScene(scenes, strings.Join(args, " "))
+	if err != nil {
+		return nil, err
+	}
+	actions := make([]sceneAction, len(s.Steps))
+	var waits time.Duration
+	for i, step := range s.Steps {
+		if actions[i], err = step.action(); err != nil {
+			return nil, fmt.Errorf("scene %s, step %d: %w", s.Name, i+1, err)
+		}
+		waits += time.Duration(step.Wait)
+	}
+
+	// The run deadline must leave room for the waits of the scene
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), DEADLINE+waits)
+	defer cancel()
+
+	result := sceneResult{Scene: s.Name, Steps: []sceneStepResult{}, Total: len(actions)}
+	for i, a := range actions {
+		step := sceneStepResult{N: i + 1, Step: a.label}
+		out, err := a.run(ctx, client)
+		if err != nil {
+			step.Error = err.Error()
+			result.Steps = append(result.Steps, step)
+			log.Printf("Scene %s step %d (%s) failed: %v", s.Name, i+1, a.label, err)
+			return result, fmt.Errorf("scene %s stopped at step %d (%s): %w", s.Name, i+1, a.label, err)
+		}
+		step.Result = fmt.Sprint(out)
+		result.Steps = append(result.Steps, step)
+		if a.starts {
+			if status, err := client.Status(ctx); err == nil {
+				claimVolumeSource(status)
+			}
+		}
+		log.Printf("Scene %s step %d (%s): %s", s.Name, i+1, a.label, step.Result)
+	}
+	return result, nil
+}
+
+// findScene returns a scene given by its number (from 1), its name or a
+// unique part of the name
+func findScene(scenes []scene, query string) (*scene, error) {
+	i, err := findByNumberOrName(scenes, "scene", func(s scene) string { return s.Name }, query)
+	if err != nil {
+		return nil, err
+	}
+	return &scenes[i], nil
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"BlueOS/bluos"
+	"github.com/johnmccabe/go-bitbar"
+)
+
+const (
+	searchResultsTTL    = time.Hour // How long the last search stays in the menu
+	searchMenuGroupSize = 10        // Results shown per group in the menu
+)
+
+// searchGroupOrder is the order of the known result groups; other categories follow
+var searchGroupOrder = []string{"Artists", "Albums", "Tracks", "Stations"}
+
+// searchGroup is a kind of search result with its items
+type searchGroup struct {
+	Name  string             `json:"name"`
+	Items []bluos.BrowseItem `json:"items"`
+}
+
+// searchCache stores the last search, so the menu can show its results and
+// commands can refer to them by number
+type searchCache struct {
+	URL       string        `json:"url"`
+	Service   string        `json:"service"`
+	Query     string        `json:"query"`
+	UpdatedAt time.Time     `json:"updatedAt"`
+	Groups    []searchGroup `json:"groups"`
+}
+
+// searchCachePath returns the location of the last search
+func searchCachePath() string {
+	return tmpPath("blueos-search.json")
+}
+
+// searchServices returns the services offered by "Open search…", set with
+// BLUE_SEARCH_SERVICES in .env as a comma-separated list. The first one is
+// searched when no service is given.
+func searchServices() []string {
+	var services []string
+	for s := range strings.SplitSeq(myConfig["BLUE_SEARCH_SERVICES"], ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			services = append(services, s)
+		}
+	}
+	if len(services) == 0 {
+		return []string{"TuneIn", "LocalMusic"}
+	}
+	return services
+}
+
+// loadSearch returns the last search on a player, or nil when there is none
+func loadSearch(playerURL string) *searchCache {
+	data, err := os.ReadFile(searchCachePath())
+	if err != nil {
+		return nil
+	}
+	var cache searchCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		log.Printf("Ignoring unreadable search results: %v", err)
+		return nil
+	}
+	if cache.URL != playerURL {
+		return nil
+	}
+	return &cache
+}
+
+// item returns the result numbered n (from 1) across all groups
+func (s *searchCache) item(n int) (*bluos.BrowseItem, error) {
+	for _, g := range s.Groups {
+		if n >= 1 && n <= len(g.Items) {
+			return &g.Items[n-1], nil
+		}
+		n -= len(g.Items)
+	}
+	return nil, fmt.Errorf("no search result with that number")
+}
+
+// searchGroupName sorts a result into artists, albums, tracks or stations by
+// the category the player put it in, then by its type
+func searchGroupName(category string, item bluos.BrowseItem) string {
+	for _, hint := range []string{strings.ToLower(category), strings.ToLower(item.Type)} {
+		switch {
+		case hint == "":
+		case strings.Contains(hint, "artist"):
+			return "Artists"
+		case strings.Contains(hint, "album"):
+			return "Albums"
+		case strings.Contains(hint, "track"), strings.Contains(hint, "song"):
+			return "Tracks"
+		case strings.Contains(hint, "station"), strings.Contains(hint, "radio"):
+			return "Stations"
+		}
+	}
+	return cmp.Or(category, "Other")
+}
+
+// groupSearchResult arranges the results of /Search in searchGroupOrder
+func groupSearchResult(result *bluos.SearchResult) []searchGroup {
+	var groups []searchGroup
+	add := func(category string, item bluos.BrowseItem) {
+		name := searchGroupName(category, item)
+		i := slices.IndexFunc(groups, func(g searchGroup) bool { return g.Name == name })
+		if i < 0 {
+			groups = append(groups, searchGroup{Name: name})
+			i = len(groups) - 1
+		}
+		groups[i].Items = append(groups[i].Items, item)
+	}
+	for _, item := range result.Items {
+		add("", item)
+	}
+	for _, c := range result.Categories {
+		for _, item := range c.Items {
+			add(c.Text, item)
+		}
+	}
+
+	rank := func(name string) int {
+		if i := slices.Index(searchGroupOrder, name); i >= 0 {
+			return i
+		}
+		return len(searchGroupOrder)
+	}
+	slices.SortStableFunc(groups, func(a, b searchGroup) int { return rank(a.Name) - rank(b.Name) })
+	return groups
+}
+
+// addSearchMenu adds "Open search…", which asks for a query, and the results
+// of the last search with a line per result: click plays it, ⌥ adds it to the queue
+func addSearchMenu(submenu *bitbar.SubMenu, client *bluos.Client) {
+	services := searchServices()
+	if len(services) == 1 {
+		submenu.Line(":magnifyingglass: Open search…").Command(createCommand(client, "search", "prompt", services[0]))
+	} else {
+		submenu.Line(":magnifyingglass: Open search…")
+		servicesMenu := submenu.NewSubMenu()
+		for _, s := range services {
+			servicesMenu.Line(s).Command(createCommand(client, "search", "prompt", s))
+		}
+	}
+
+	search := loadSearch(client.BaseURL)
+	if search == nil || time.Since(search.UpdatedAt) > searchResultsTTL {
+		return
+	}
+	submenu.Line(fmt.Sprintf(":text.magnifyingglass: Results for %q", search.Query)).Length(MAX)
+	resultsMenu := submenu.NewSubMenu()
+	resultsMenu.Line(fmt.Sprintf("%s · hold ⌥ to add to the queue", search.Service)).Color("gray")
+
+	n := 0
+	for _, g := range search.Groups {
+		resultsMenu.Line("---")
+		resultsMenu.Line(fmt.Sprintf("%s (%d)", g.Name, len(g.Items))).Color("gray")
+		for i, item := range g.Items {
+			n++
+			if i >= searchMenuGroupSize {
+				continue
+			}
+			label := browseLabel(item)
+			if !item.Playable() {
+				resultsMenu.Line(label).Length(MAX).Color("gray")
+				continue
+			}
+			resultsMenu.Line(":play.fill: " + label).Length(MAX).Command(createCommand(client, "search", "play", strconv.Itoa(n)))
+			if item.Queueable() {
+				resultsMenu.Line(":text.append: " + label).Length(MAX).Alternate(true).Command(createCommand(client, "search", "add", strconv.Itoa(n)))
+			}
+		}
+	}
+	resultsMenu.Line("---")
+	resultsMenu.Line(":xmark.circle: Clear results").Command(createCommand(client, "search", "clear"))
+}
+
+// searchEntry is a numbered result in the output of the search command
+type searchEntry struct {
+	N         int    `json:"n"`
+	Name      string `json:"name"`
+	Type      string `json:"type,omitempty"`
+	Playable  bool   `json:"playable"`
+	Queueable bool   `json:"queueable"`
+}
+
+// searchList is the output of the search command
+type searchList struct {
+	Service string            `json:"service"`
+	Query   string            `json:"query"`
+	Groups  []searchListGroup `json:"groups"`
+}
+
+// searchListGroup is a group of numbered results
+type searchListGroup struct {
+	Name  string        `json:"name"`
+	Items []searchEntry `json:"items"`
+}
+
+// newSearchList numbers the results of a search across its groups
+func newSearchList(search *searchCache) searchList {
+	list := searchList{Service: search.Service, Query: search.Query, Groups: []searchListGroup{}}
+	n := 0
+	for _, g := range search.Groups {
+		group := searchListGroup{Name: g.Name}
+		for _, item := range g.Items {
+			n++
+			group.Items = append(group.Items, searchEntry{N: n, Name: browseLabel(item), Type: item.Type, Playable: item.Playable(), Queueable: item.Queueable()})
+		}
+		list.Groups = append(list.Groups, group)
+	}
+	return list
+}
+
+func (l searchList) String() string {
+	if len(l.Groups) == 0 {
+		return fmt.Sprintf("Nothing found for %q in %s", l.Query, l.Service)
+	}
+	var b strings.Builder
+	for i, g := range l.Groups {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s:\n", g.Name)
+		for _, e := range g.Items {
+			marker := " "
+			switch {
+			case e.Queueable:
+				marker = "+"
+			case e.Playable:
+				marker = "▶"
+			}
+			fmt.Fprintf(&b, "%s %3d  %s\n", marker, e.N, e.Name)
+		}
+	}
+	b.WriteString("\n(▶ play, + play or add to the queue: search play <n>, search add <n>)")
+	return b.String()
+}
+
+// cmdSearch searches a service and keeps the results for the menu, plays or
+// queues a numbered result of the last search, or asks for a query in a dialog
+func cmdSearch(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "play", "add":
+			if len(args) != 2 {
+				return nil, fmt.Errorf("usage: search %s <n>", args[0])
+			}
+			return playSearchResult(ctx, client, args[0] == "add", args[1])
+		case "clear":
+			if err := os.Remove(searchCachePath()); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			return messageResult{"Search results cleared"}, nil
+		case "prompt":
+			service := searchServices()[0]
+			if len(args) > 1 {
+				service = args[1]
+			}
+			query, err := promptSearchQuery(service)
+			if err != nil || query == "" {
+				return messageResult{"Search cancelled"}, err
+			}
+			// The run deadline must not include the time spent typing
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), DEADLINE)
+			defer cancel()
+			return runSearch(ctx, client, service, query)
+		}
+	}
+
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	service := fs.String("service", searchServices()[0], "music service to search, e.g. TuneIn, Tidal or LocalMusic")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	query := strings.Join(fs.Args(), " ")
+	if query == "" {
+		return nil, errors.New("usage: search [--service <name>] <query>")
+	}
+	return runSearch(ctx, client, *service, query)
+}
+
+// runSearch searches a service and saves the grouped results as the last search
+func runSearch(ctx context.Context, client *bluos.Client, service, query string) (any, error) {
+	result, err := client.Search(ctx, service, query)
+	if err != nil {
+		return nil, err
+	}
+	search := &searchCache{URL: client.BaseURL, Service: service, Query: query, UpdatedAt: time.Now(), Groups: groupSearchResult(result)}
+
+	data, err := json.Marshal(search)
+	if err == nil {
+		err = os.WriteFile(searchCachePath(), data, 0o600)
+	}
+	if err != nil {
+		log.Printf("Failed to save search results: %v", err)
+	}
+	return newSearchList(search), nil
+}
+
+// playSearchResult plays a result of the last search now, or adds it to the queue
+func playSearchResult(ctx context.Context, client *bluos.Client, queue bool, arg string) (any, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid result number %q", arg)
+	}
+	search := loadSearch(client.BaseURL)
+	if search == nil {
+		return nil, errors.New("no search results, run search <query> first")
+	}
+	item, err := search.item(n)
+	if err != nil {
+		return nil, err
+	}
+
+	if queue {
+		if err := client.QueueItem(ctx, *item); err != nil {
+			return nil, err
+		}
+		return messageResult{fmt.Sprintf("Added %s to the queue", item.Text)}, nil
+	}
+	return playBrowseItem(ctx, client, *item)
+}
+
+// promptSearchQuery asks for a search query in a dialog. It returns an empty
+// query when the dialog is cancelled.
+func promptSearchQuery(service string) (string, error) {
+	script := fmt.Sprintf(`text returned of (display dialog "Search %s for:" default answer "" with title "BluOS")`, strings.ReplaceAll(service, `"`, ""))
+	out, err := exec.Command("osascript", "-e", script).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && strings.Contains(string(exitErr.Stderr), "-128") {
+			return "", nil // User cancelled
+		}
+		return "", fmt.Errorf("search dialog: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+
+	"BlueOS/bluos"
+	"github.com/johnmccabe/go-bitbar"
+)
+
+const (
+	sleepFadeDuration = 5 * time.Minute  // Volume ramp at the end of a sleep with fade
+	sleepFadeStep     = 10 * time.Second // Interval between cancellation checks before the fade
+)
+
+// sleepFadeOptions are the sleep with fade durations offered in the menu, in minutes
+var sleepFadeOptions = []int{15, 30, 60}
+
+// fadeSleep is a local sleep timer that fades the volume out before stopping.
+// A detached worker process carries it out; replacing or removing the file
+// cancels the worker.
+type fadeSleep struct {
+	URL   string    `json:"url"`
+	Until time.Time `json:"until"`
+}
+
+// fadeSleepPath returns the location of the sleep with fade job
+func fadeSleepPath() string {
+	return tmpPath("blueos-sleep.json")
+}
+
+// loadFadeSleep returns the pending sleep with fade, or nil when there is none
+func loadFadeSleep() *fadeSleep {
+	data, err := os.ReadFile(fadeSleepPath())
+	if err != nil {
+		return nil
+	}
+	var job fadeSleep
+	if err := json.Unmarshal(data, &job); err != nil {
+		log.Printf("Ignoring unreadable sleep job: %v", err)
+		return nil
+	}
+	return &job
+}
+
+// cancelFadeSleep removes the sleep with fade job, which stops its worker
+func cancelFadeSleep() {
+	if err := os.Remove(fadeSleepPath()); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove sleep job: %v", err)
+	}
+}
+
+// current reports whether job is still the pending sleep with fade
+func (job *fadeSleep) current() bool {
+	latest := loadFadeSleep()
+	return latest != nil && latest.URL == job.URL && latest.Until.Equal(job.Until)
+}
+
+// sleepRemaining returns the minutes until the player sleeps, and whether
+// that is a local sleep with fade rather than the player's own timer
+func sleepRemaining(client *bluos.Client, state *bluos.StateXML) (minutes int, fade bool) {
+	if job := loadFadeSleep(); job != nil && job.URL == client.BaseURL && time.Until(job.Until) > 0 {
+		return int(math.Ceil(time.Until(job.Until).Minutes())), true
+	}
+	return bluos.ParseSleep(state.Sleep), false
+}
+
+// addSleepMenu adds a Sleep timer submenu with the player's timer values, the
+// local sleep with fade and the remaining minutes when a timer is set
+func addSleepMenu(submenu *bitbar.SubMenu, client *bluos.Client, state *bluos.StateXML) {
+	minutes, fade := sleepRemaining(client, state)
+	if minutes == 0 && state.State != "play" && state.State != "stream" && state.State != "pause" {
+		return
+	}
+
+	switch {
+	case minutes > 0 && fade:
+		submenu.Line(fmt.Sprintf(":moon.zzz.fill: Sleep in %d min (fade)", minutes)).Color("blue")
+	case minutes > 0:
+		submenu.Line(fmt.Sprintf(":moon.zzz.fill: Sleep in %d min", minutes)).Color("blue")
+	default:
+		submenu.Line(":moon.zzz: Sleep timer")
+	}
+	sleepMenu := submenu.NewSubMenu()
+
+	for _, m := range bluos.SleepSteps {
+		if m > 0 {
+			sleepMenu.Line(fmt.Sprintf("%d minutes", m)).Command(createCommand(client, "sleep", strconv.Itoa(m)))
+		}
+	}
+	sleepMenu.Line("---")
+	sleepMenu.Line("Fade out, then stop").Color("gray")
+	for _, m := range sleepFadeOptions {
+		sleepMenu.Line(fmt.Sprintf(":speaker.wave.1: %d minutes with fade", m)).Command(createCommand(client, "sleep", "fade", strconv.Itoa(m)))
+	}
+	if minutes > 0 {
+		sleepMenu.Line("---")
+		sleepMenu.Line(":moon.zzz: Turn off").Command(createCommand(client, "sleep", "off"))
+	}
+}
+
+// sleepResult is the output of the sleep command
+type sleepResult struct {
+	Minutes int  `json:"minutes"` // 0 when no timer is set
+	Fade    bool `json:"fade"`
+}
+
+func (r sleepResult) String() string {
+	switch {
+	case r.Minutes == 0:
+		return "Sleep timer off"
+	case r.Fade:
+		return fmt.Sprintf("Sleep in %d min (fade)", r.Minutes)
+	default:
+		return fmt.Sprintf("Sleep in %d min", r.Minutes)
+	}
+}
+
+// cmdSleep shows or sets the sleep timer. Plain minutes use the player's own
+// timer; "fade" runs a local timer that lowers the volume before stopping.
+func cmdSleep(ctx context.Context, client *bluos.Client, args []string) (any, error) {
+	status, err := client.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(args) == 0:
+		minutes, fade := sleepRemaining(client, status)
+		return sleepResult{Minutes: minutes, Fade: fade}, nil
+	case len(args) == 1 && args[0] == "off":
+		cancelFadeSleep()
+		if err := setPlayerSleep(ctx, client, status, 0); err != nil {
+			return nil, err
+		}
+		return sleepResult{}, nil
+	case len(args) == 2 && args[0] == "fade":
+		minutes, err := strconv.Atoi(args[1])
+		if err != nil || time.Duration(minutes)*time.Minute <= sleepFadeDuration {
+			return nil, fmt.Errorf("invalid duration %q (more than %v needed for the fade)", args[1], sleepFadeDuration)
+		}
+		// The player's own timer would cut the fade short
+		if err := setPlayerSleep(ctx, client, status, 0); err != nil {
+			return nil, err
+		}
+		if err := startFadeSleep(client.BaseURL, time.Duration(minutes)*time.Minute); err != nil {
+			return nil, err
+		}
+		return sleepResult{Minutes: minutes, Fade: true}, nil
+	case len(args) == 1:
+		minutes, err := strconv.Atoi(args[0])
+		if err != nil || minutes <= 0 || !slices.Contains(bluos.SleepSteps, minutes) {
+			return nil, fmt.Errorf("invalid sleep time %q (use 15, 30, 45, 60 or 90)", args[0])
+		}
+		cancelFadeSleep()
+		if err := setPlayerSleep(ctx, client, status, minutes); err != nil {
+			return nil, err
+		}
+		return sleepResult{Minutes: minutes}, nil
+	default:
+		return nil, errors.New("usage: sleep [<minutes> | fade <minutes> | off]")
+	}
+}
+
+// setPlayerSleep cycles the player's sleep timer until it reaches minutes,
+// since /Sleep can only step to the next value
+func setPlayerSleep(ctx context.Context, client *bluos.Client, status *bluos.StateXML, minutes int) error {
+	current := bluos.ParseSleep(status.Sleep)
+	for range len(bluos.SleepSteps) + 1 {
+		if current == minutes {
+			return nil
+		}
+		var err error
+		if current, err = client.CycleSleep(ctx); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("sleep timer did not reach %d minutes", minutes)
+}
+
+// startFadeSleep records a sleep with fade and starts the worker that carries
+// it out in the background
+func startFadeSleep(playerURL string, after time.Duration) error {
+	data, err := json.Marshal(fadeSleep{URL: playerURL, Until: time.Now().Add(after).Round(time.Second)})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(fadeSleepPath(), data, 0o600); err != nil {
+		return fmt.Errorf("save sleep job: %w", err)
+	}
+
+	// The worker outlives this command and SwiftBar, so it gets its own session
+	worker := exec.Command(executablePath(), "cmd", "--url", playerURL, "sleep-worker")
+	worker.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := worker.Start(); err != nil {
+		cancelFadeSleep()
+		return fmt.Errorf("start sleep worker: %w", err)
+	}
+	return worker.Process.Release()
+}
+
+// runSleepWorker waits for the pending sleep with fade, then hands the last
+// sleepFadeDuration to a fade-out, which pauses playback and restores the
+// volume for the next time. The sleep ends with the fade, also when that is
+// cancelled or the volume is changed by hand.
+func runSleepWorker(playerURL string) int {
+	job := loadFadeSleep()
+	if job == nil || job.URL != playerURL {
+		log.Printf("No sleep job for %s", playerURL)
+		return 1
+	}
+	client := bluos.NewClient(playerURL)
+	ctx := context.Background()
+
+	fadeStart := job.Until.Add(-sleepFadeDuration)
+	for time.Now().Before(fadeStart) {
+		time.Sleep(min(sleepFadeStep, time.Until(fadeStart)))
+		if !job.current() {
+			log.Printf("Sleep cancelled")
+			return 0
+		}
+	}
+	defer func() {
+		if job.current() {
+			cancelFadeSleep()
+		}
+	}()
+
+	vol, err := client.Volume(ctx)
+	if err != nil {
+		log.Printf("Sleep fade could not read the volume: %v", err)
+		return 1
+	}
+	fade := fadeJob{
+		URL:      playerURL,
+		Kind:     "out",
+		From:     vol.Level,
+		Duration: max(0, time.Until(job.Until)),
+		Started:  time.Now(),
+	}
+	if err := saveFadeJob(fade); err != nil {
+		log.Printf("Sleep fade could not start: %v", err)
+		return 1
+	}
+	log.Printf("Fading out from %d%% until %s", fade.From, job.Until.Format(time.Kitchen))
+	if err := runFade(ctx, client, &fade); err != nil {
+		log.Printf("Sleep fade failed: %v", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"BlueOS/bluos"
+)
+
+const discoveryDeadline = 10 * time.Second // Budget for locating the player, before the DEADLINE of the fetch
+
+// Snapshot holds everything the menu needs to render. It is either fetched
+// directly by the plugin or served by the daemon over its Unix socket.
+type Snapshot struct {
+	URL        string              `json:"url"` // Empty when no player was found
+	Status     *bluos.StateXML     `json:"status,omitempty"`
+	Volume     *bluos.VolumeStatus `json:"volume,omitempty"`
+	Presets    *bluos.Presets      `json:"presets,omitempty"`
+	Queue      *bluos.Playlist     `json:"queue,omitempty"`
+	Rooms      []room              `json:"rooms,omitempty"` // Every player on the network, with grouping
+	Browse     []browseNode        `json:"browse,omitempty"`
+	StatusErr  *SectionError       `json:"statusErr,omitempty"`
+	VolumeErr  *SectionError       `json:"volumeErr,omitempty"`
+	PresetsErr *SectionError       `json:"presetsErr,omitempty"`
+	QueueErr   *SectionError       `json:"queueErr,omitempty"`
+	RoomsErr   *SectionError       `json:"roomsErr,omitempty"`
+	BrowseErr  *SectionError       `json:"browseErr,omitempty"`
+	Reachable  bool                `json:"reachable"` // Device answers at all, even if /Status fails
+	StatusAt   time.Time           `json:"statusAt"`  // When Status was fetched, to advance the track time
+	UpdatedAt  time.Time           `json:"updatedAt"`
+}
+
+// SectionError describes why a menu section could not be fetched
+type SectionError struct {
+	Message string `json:"message"`
+	Parse   bool   `json:"parse"`   // The player answered but the XML could not be parsed
+	Timeout bool   `json:"timeout"` // The deadline passed before the player answered
+}
+
+func (e *SectionError) Error() string {
+	return e.Message
+}
+
+// newSectionError converts a client error into a SectionError. Only a call
+// that itself ran out of time counts as a timeout, not one that failed while
+// other sections used up the deadline.
+func newSectionError(err error) *SectionError {
+	if err == nil {
+		return nil
+	}
+	var parseErr *bluos.ParseError
+	return &SectionError{
+		Message: err.Error(),
+		Parse:   errors.As(err, &parseErr),
+		Timeout: errors.Is(err, context.DeadlineExceeded),
+	}
+}
+
+// loadSnapshot returns the daemon's cached snapshot when a daemon is running,
+// otherwise it discovers the player and fetches a fresh snapshot. Discovery
+// gets its own budget, so a stale cache or a silent mDNS lookup does not use
+// up the DEADLINE the player has to answer.
+func loadSnapshot(ctx context.Context) *Snapshot {
+	if snap, err := readDaemonSnapshot(); err == nil {
+		log.Printf("Using daemon snapshot from %s", snap.UpdatedAt.Format(time.RFC3339))
+		return snap
+	} else {
+		log.Printf("Daemon not available, fetching directly: %v", err)
+	}
+
+	// Get BluOS device URL (try discovery first, fall back to config)
+	discoverCtx, cancel := context.WithTimeout(ctx, discoveryDeadline)
+	bluePlayerUrl, err := getBluOSPlayerURL(discoverCtx, myConfig["BLUE_URL"])
+	cancel()
+	if err != nil {
+		log.Printf("Failed to determine BluOS player URL: %v", err)
+		return &Snapshot{UpdatedAt: time.Now()}
+	}
+	log.Printf("Using BluOS URL: %s", bluePlayerUrl)
+
+	ctx, cancel = context.WithTimeout(ctx, DEADLINE)
+	defer cancel()
+	client := bluos.NewClient(bluePlayerUrl)
+	// An attempt ends well before the deadline, so a player that never answers
+	// is reported as such instead of as slow
+	client.Timeout = min(client.Timeout, DEADLINE/2)
+	snap := fetchSnapshot(ctx, client)
+	if snap.Status != nil {
+		if vol := learnVolume(ctx, client, snap.Status); vol != nil {
+			snap.Volume = vol
+		}
+	}
+	return snap
+}
+
+// fetchSnapshot fetches status, presets and volume from the player concurrently.
+// Sections that miss the ctx deadline are marked as timed out instead of
+// holding up the rest of the menu.
+func fetchSnapshot(ctx context.Context, client *bluos.Client) *Snapshot {
+	snap := &Snapshot{URL: client.BaseURL, Reachable: true}
+
+	var (
+		wg                                                              sync.WaitGroup
+		statusErr, presetsErr, volumeErr, queueErr, roomsErr, browseErr error
+	)
+	wg.Go(func() {
+		if snap.Status, statusErr = client.Status(ctx); statusErr != nil {
+			return
+		}
+		snap.StatusAt = time.Now()
+		// The queue and rooms are keyed by the playlist id and sync status from /Status
+		var keyed sync.WaitGroup
+		keyed.Go(func() { snap.Queue, queueErr = loadQueue(ctx, client, snap.Status.Pid, snap.Status.Song) })
+		keyed.Go(func() { snap.Rooms, roomsErr = loadRooms(ctx, client, snap.Status.SyncStat) })
+		keyed.Wait()
+	})
+	wg.Go(func() { snap.Presets, presetsErr = client.Presets(ctx) })
+	wg.Go(func() { snap.Volume, volumeErr = client.Volume(ctx) })
+	wg.Go(func() { snap.Browse, browseErr = loadBrowse(ctx, client) })
+	wg.Wait()
+
+	snap.StatusErr = newSectionError(statusErr)
+	snap.PresetsErr = newSectionError(presetsErr)
+	snap.VolumeErr = newSectionError(volumeErr)
+	snap.QueueErr = newSectionError(queueErr)
+	snap.RoomsErr = newSectionError(roomsErr)
+	snap.BrowseErr = newSectionError(browseErr)
+
+	if statusErr != nil {
+		log.Printf("Failed to get BluOS status XML: %v", statusErr)
+		if !snap.StatusErr.Parse && !snap.StatusErr.Timeout {
+			// Check if the device is reachable at all
+			snap.Reachable = isDeviceReachable(ctx, client)
+		}
+	}
+
+	// Only downloads images that are not cached yet
+	cacheArtwork(ctx, client, snap)
+
+	snap.UpdatedAt = time.Now()
+	return snap
+}
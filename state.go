@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// pluginState holds choices that must survive reboots, unlike the caches in
+// TMPDIR. It lives in the user config directory so the menu, the CLI and the
+// daemon share it regardless of their environment.
+type pluginState struct {
+	PlayerURL  string `json:"playerUrl,omitempty"`  // Player picked in the Players submenu
+	PlayerName string `json:"playerName,omitempty"` // Its name, to find it again when its address changes
+
+	Volumes      map[string]int `json:"volumes,omitempty"`      // Learned level per preset or service, see volumeSource
+	VolumeSource string         `json:"volumeSource,omitempty"` // Source playing when the volume was last learned
+	AutoVolume   *autoVolume    `json:"autoVolume,omitempty"`   // Last automatic change, for undo
+
+	AlarmRuns map[string]time.Time `json:"alarmRuns,omitempty"` // Last occurrence handled per alarm, see alarm.key
+}
+
+// configPath returns the location of a file in the plugin's config directory
+func configPath(name string) string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		log.Printf("No user config directory, keeping %s in TMPDIR: %v", name, err)
+		return tmpPath("blueos-" + name)
+	}
+	return filepath.Join(dir, "BluOS-plugin", name)
+}
+
+// statePath returns the location of the state file
+func statePath() string {
+	return configPath("state.json")
+}
+
+// stateMu serializes state updates within a process; the lock file next to
+// the state does the same between the menu, the CLI and the daemon
+var stateMu sync.Mutex
+
+// readState reads the state file. A missing file yields an empty state.
+func readState() (*pluginState, error) {
+	state := &pluginState{}
+	data, err := os.ReadFile(statePath())
+	if os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("read %s: %w", statePath(), err)
+	}
+	return state, nil
+}
+
+// loadState reads the state file. A missing or unreadable file yields an empty state.
+func loadState() *pluginState {
+	state, err := readState()
+	if err != nil {
+		log.Printf("Ignoring unreadable state: %v", err)
+		return &pluginState{}
+	}
+	return state
+}
+
+// updateState applies fn to the stored state and writes it back. Updates
+// are serialized, so concurrent ones are not lost, and an unreadable state
+// file is left alone rather than replaced by an empty state.
+func updateState(fn func(state *pluginState)) error {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	unlock, err := lockFile(statePath() + ".lock")
+	if err != nil {
+		return fmt.Errorf("lock state: %w", err)
+	}
+	defer unlock()
+
+	state, err := readState()
+	if err != nil {
+		return err
+	}
+	fn(state)
+	return writeConfigFile(statePath(), state)
+}
+
+// lockFile takes an exclusive lock on path, waiting while another process
+// holds it, and returns the function that releases it
+func lockFile(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// writeConfigFile writes v as JSON to a file in the config directory,
+// indented and with URLs left unescaped so it stays easy to edit by hand. The
+// file is replaced in one step, so readers never see half of it.
+func writeConfigFile(path string, v any) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"BlueOS/bluos"
+	"github.com/johnmccabe/go-bitbar"
+)
+
+// quietDefaultMax is the level cap during quiet hours without BLUE_QUIET_VOLUME_MAX
+const quietDefaultMax = 25
+
+// volumeLimit is the highest level the plugin may set at a given time
+type volumeLimit struct {
+	Level  int    `json:"level"`
+	Reason string `json:"reason,omitempty"` // Which setting decides the cap, empty without one
+}
+
+// active reports whether any cap is below full volume
+func (l volumeLimit) active() bool {
+	return l.Level < 100
+}
+
+// currentVolumeLimit returns the tightest of the caps set in .env:
+// BLUE_VOLUME_MAX (level), BLUE_VOLUME_MAX_DB (dB, converted with Db2vol) and
+// BLUE_QUIET_VOLUME_MAX during BLUE_QUIET_HOURS (e.g. 22:00-07:00)
+func currentVolumeLimit(now time.Time) volumeLimit {
+	limit := volumeLimit{Level: 100}
+	tighten := func(level int, reason string) {
+		if level < limit.Level {
+			limit = volumeLimit{Level: max(0, level), Reason: reason}
+		}
+	}
+
+	if level, err := strconv.Atoi(myConfig["BLUE_VOLUME_MAX"]); err == nil {
+		tighten(level, fmt.Sprintf("max %d%%", level))
+	}
+	if db, err := strconv.ParseFloat(myConfig["BLUE_VOLUME_MAX_DB"], 64); err == nil {
+		tighten(int(math.Floor(Db2vol(db))), fmt.Sprintf("max %.1f dB", db))
+	}
+	if until, ok := quietHours(now); ok {
+		level := quietDefaultMax
+		if l, err := strconv.Atoi(myConfig["BLUE_QUIET_VOLUME_MAX"]); err == nil {
+			level = l
+		}
+		tighten(level, "quiet hours until "+until)
+	}
+	return limit
+}
+
+// quietHours reports whether now falls in BLUE_QUIET_HOURS and when they end
+func quietHours(now time.Time) (until string, ok bool) {
+	spec := myConfig["BLUE_QUIET_HOURS"]
+	if spec == "" {
+		return "", false
+	}
+	from, to, found := strings.Cut(spec, "-")
+	start, err1 := time.Parse("15:04", strings.TrimSpace(from))
+	end, err2 := time.Parse("15:04", strings.TrimSpace(to))
+	if !found || err1 != nil || err2 != nil {
+		log.Printf("Ignoring invalid BLUE_QUIET_HOURS %q (expected e.g. 22:00-07:00)", spec)
+		return "", false
+	}
+
+	minute := now.Hour()*60 + now.Minute()
+	startMin, endMin := start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+	if startMin <= endMin {
+		ok = startMin <= minute && minute < endMin
+	} else {
+		// Quiet hours past midnight
+		ok = minute >= startMin || minute < endMin
+	}
+	return end.Format("15:04"), ok
+}
+
+// setLimitedVolume sets a volume level, lowered to the current limit
+func setLimitedVolume(ctx context.Context, client *bluos.Client, level int) (*bluos.VolumeStatus, error) {
+	if limit := currentVolumeLimit(time.Now()); level > limit.Level {
+		log.Printf("Volume %d%% capped to %d%% (%s)", level, limit.Level, limit.Reason)
+		level = limit.Level
+	}
+	return client.SetVolume(ctx, level)
+}
+
+// adjustLimitedVolume changes the volume by db, stopping at the current limit
+func adjustLimitedVolume(ctx context.Context, client *bluos.Client, db float64) (*bluos.VolumeStatus, error) {
+	limit := currentVolumeLimit(time.Now())
+	if db > 0 && limit.active() {
+		vol, err := client.Volume(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if Db2vol(vol.Db+db) > float64(limit.Level) {
+			log.Printf("Volume change of %+.1f dB capped to %d%% (%s)", db, limit.Level, limit.Reason)
+			return client.SetVolume(ctx, limit.Level)
+		}
+	}
+	vol, err := client.AdjustVolume(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	return enforceVolumeLimit(ctx, client, vol)
+}
+
+// enforceVolumeLimit lowers the volume when it is above the current limit,
+// e.g. after unmuting or a dB step the player rounded up
+func enforceVolumeLimit(ctx context.Context, client *bluos.Client, vol *bluos.VolumeStatus) (*bluos.VolumeStatus, error) {
+	if limit := currentVolumeLimit(time.Now()); vol.Level > limit.Level {
+		log.Printf("Volume %d%% above the limit, lowering to %d%% (%s)", vol.Level, limit.Level, limit.Reason)
+		return client.SetVolume(ctx, limit.Level)
+	}
+	return vol, nil
+}
+
+// addVolumeLimitInfo shows the cap in force, if any
+func addVolumeLimitInfo(submenu *bitbar.SubMenu, limit volumeLimit) {
+	if limit.active() {
+		submenu.Line(fmt.Sprintf(":lock.fill: Limited to %d%% (%s)", limit.Level, limit.Reason)).Color("gray").Length(MAX)
+	}
+}
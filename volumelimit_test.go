@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// withConfig replaces myConfig for the duration of a test
+func withConfig(t *testing.T, config map[string]string) {
+	t.Helper()
+	saved := myConfig
+	myConfig = config
+	t.Cleanup(func() { myConfig = saved })
+}
+
+func TestQuietHours(t *testing.T) {
+	tests := []struct {
+		name   string
+		spec   string
+		now    string
+		until  string
+		active bool
+	}{
+		{"unset", "", "23:00", "", false},
+		{"invalid", "22:00", "23:00", "", false},
+		{"invalid time", "22:00-25:00", "23:00", "", false},
+		{"same day inside", "13:00-15:00", "14:30", "15:00", true},
+		{"same day at start", "13:00-15:00", "13:00", "15:00", true},
+		{"same day at end", "13:00-15:00", "15:00", "15:00", false},
+		{"same day before", "13:00-15:00", "12:59", "15:00", false},
+		{"past midnight evening", "22:00-07:00", "23:30", "07:00", true},
+		{"past midnight at start", "22:00-07:00", "22:00", "07:00", true},
+		{"past midnight at midnight", "22:00-07:00", "00:00", "07:00", true},
+		{"past midnight morning", "22:00-07:00", "06:59", "07:00", true},
+		{"past midnight at end", "22:00-07:00", "07:00", "07:00", false},
+		{"past midnight daytime", "22:00-07:00", "12:00", "07:00", false},
+		{"spaces around times", " 22:00 - 07:00 ", "01:00", "07:00", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withConfig(t, map[string]string{"BLUE_QUIET_HOURS": tt.spec})
+			now, err := time.Parse("15:04", tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			until, active := quietHours(now)
+			if active != tt.active || (active && until != tt.until) {
+				t.Errorf("quietHours(%s) = %q, %v, want %q, %v", tt.now, until, active, tt.until, tt.active)
+			}
+		})
+	}
+}
+
+func TestCurrentVolumeLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		config map[string]string
+		now    string
+		want   volumeLimit
+	}{
+		{"no caps", map[string]string{}, "12:00", volumeLimit{Level: 100}},
+		{"level cap", map[string]string{"BLUE_VOLUME_MAX": "70"}, "12:00", volumeLimit{70, "max 70%"}},
+		{"dB cap", map[string]string{"BLUE_VOLUME_MAX_DB": "-12"}, "12:00", volumeLimit{63, "max -12.0 dB"}},
+		{"tightest wins", map[string]string{"BLUE_VOLUME_MAX": "50", "BLUE_VOLUME_MAX_DB": "-12"}, "12:00", volumeLimit{50, "max 50%"}},
+		{"quiet hours default", map[string]string{"BLUE_QUIET_HOURS": "22:00-07:00"}, "23:00", volumeLimit{quietDefaultMax, "quiet hours until 07:00"}},
+		{"quiet hours set", map[string]string{"BLUE_QUIET_HOURS": "22:00-07:00", "BLUE_QUIET_VOLUME_MAX": "15", "BLUE_VOLUME_MAX": "70"}, "02:00", volumeLimit{15, "quiet hours until 07:00"}},
+		{"outside quiet hours", map[string]string{"BLUE_QUIET_HOURS": "22:00-07:00", "BLUE_VOLUME_MAX": "70"}, "12:00", volumeLimit{70, "max 70%"}},
+		{"negative level", map[string]string{"BLUE_VOLUME_MAX": "-5"}, "12:00", volumeLimit{0, "max -5%"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withConfig(t, tt.config)
+			now, err := time.Parse("15:04", tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := currentVolumeLimit(now); got != tt.want {
+				t.Errorf("currentVolumeLimit(%s) = %+v, want %+v", tt.now, got, tt.want)
+			}
+		})
+	}
+}